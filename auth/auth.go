@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+	"github.com/pelicanplatform/pelicanobjectstager/logger"
+)
+
+var log = logger.With(zap.String("component", "auth"))
+
+// Scopes enforced per route group
+const (
+	ScopeStage       = "stage"
+	ScopeReadRecords = "read_records"
+	ScopeAdmin       = "admin" // Grants every other scope as well
+)
+
+// Authentication methods reported in Identity.Method
+const (
+	MethodStaticToken = "static_token"
+	MethodJWT         = "jwt"
+	MethodClientCert  = "client_cert"
+)
+
+// identityKey is the gin context key holding the authenticated Identity
+const identityKey = "identity"
+
+// ErrInvalidToken is returned when a bearer token is present but cannot be verified
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// Identity is the authenticated caller of a request
+type Identity struct {
+	Subject string   `json:"subject"`
+	Method  string   `json:"method"`
+	Scopes  []string `json:"scopes"`
+}
+
+// HasScope reports whether the identity was granted the scope, directly or through admin
+func (id *Identity) HasScope(scope string) bool {
+	for _, granted := range id.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate resolves the bearer token of the request, or else its verified client
+// certificate, into an Identity. It returns nil without error when the request carries
+// neither.
+func Authenticate(r *http.Request) (*Identity, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return ClientCertIdentity(r), nil
+	}
+
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return nil, ErrInvalidToken
+	}
+	token = strings.TrimSpace(token)
+
+	for _, static := range config.AppConfig.Server.Auth.Tokens {
+		if static.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(static.Token)) == 1 {
+			return &Identity{Subject: static.Name, Method: MethodStaticToken, Scopes: static.Scopes}, nil
+		}
+	}
+
+	// Anything that is not a static token must be a JWT signed by a key of the local JWKS
+	if config.AppConfig.Server.Auth.JWKSFile != "" && strings.Count(token, ".") == 2 {
+		return verifyJWT(token)
+	}
+
+	return nil, ErrInvalidToken
+}
+
+// ClientCertIdentity maps the verified client certificate of the request to an Identity,
+// or returns nil if the request did not present one.
+func ClientCertIdentity(r *http.Request) *Identity {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	return &Identity{
+		Subject: cert.Subject.String(),
+		Method:  MethodClientCert,
+		Scopes:  config.AppConfig.Server.Auth.ClientCertScopes,
+	}
+}
+
+// SetIdentity stores the authenticated identity in the request context
+func SetIdentity(c *gin.Context, identity *Identity) {
+	c.Set(identityKey, identity)
+}
+
+// GetIdentity returns the authenticated identity of the request, or nil if anonymous
+func GetIdentity(c *gin.Context) *Identity {
+	value, ok := c.Get(identityKey)
+	if !ok {
+		return nil
+	}
+	identity, _ := value.(*Identity)
+	return identity
+}
+
+// IdentitySubject returns the subject of the request's identity, or "anonymous"
+func IdentitySubject(c *gin.Context) string {
+	if identity := GetIdentity(c); identity != nil {
+		return identity.Subject
+	}
+	return "anonymous"
+}
+
+// IsOwnerOrAdmin reports whether the request may act on a resource requested by owner:
+// its identity must have that subject or the admin scope. Everything is allowed while
+// authentication is disabled.
+func IsOwnerOrAdmin(c *gin.Context, owner string) bool {
+	if !config.AppConfig.Server.Auth.Enabled {
+		return true
+	}
+	identity := GetIdentity(c)
+	if identity == nil {
+		return false
+	}
+	return identity.Subject == owner || identity.HasScope(ScopeAdmin)
+}
+
+// RequireScope rejects requests whose identity lacks the scope: 401 when the request is
+// unauthenticated and 403 when the identity is not allowed. It lets everything through
+// while authentication is disabled.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.AppConfig.Server.Auth.Enabled {
+			c.Next()
+			return
+		}
+
+		jobID := c.GetString("job_id")
+		identity := GetIdentity(c)
+		if identity == nil {
+			c.Header("WWW-Authenticate", `Bearer realm="pelican-object-stager"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"job_id": jobID,
+				"error":  "Authentication required",
+			})
+			return
+		}
+
+		if !identity.HasScope(scope) {
+			log.Warn("Request denied, missing scope",
+				zap.String("job_id", jobID),
+				zap.String("identity", identity.Subject),
+				zap.String("required_scope", scope),
+				zap.Strings("scopes", identity.Scopes),
+			)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"job_id":         jobID,
+				"error":          "Insufficient scope",
+				"required_scope": scope,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
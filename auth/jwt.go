@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+)
+
+// jwksCache holds the parsed JWKS file, reloaded whenever the file changes on disk
+var jwksCache struct {
+	sync.Mutex
+	modTime time.Time
+	keys    jwk.Set
+}
+
+// loadJWKS returns the key set from the configured JWKS file
+func loadJWKS() (jwk.Set, error) {
+	path := config.AppConfig.Server.Auth.JWKSFile
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat JWKS file %s: %v", path, err)
+	}
+
+	jwksCache.Lock()
+	defer jwksCache.Unlock()
+
+	if jwksCache.keys != nil && info.ModTime().Equal(jwksCache.modTime) {
+		return jwksCache.keys, nil
+	}
+
+	keys, err := jwk.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file %s: %v", path, err)
+	}
+	log.Info("Loaded JWKS", zap.String("path", path), zap.Int("keys", keys.Len()))
+
+	jwksCache.keys = keys
+	jwksCache.modTime = info.ModTime()
+	return keys, nil
+}
+
+// verifyJWT checks the token signature against the local JWKS, validates its claims and
+// maps the space-separated "scope" claim into the identity's scopes. Tokens without an
+// "exp" claim are rejected so that a leaked token cannot be used forever.
+func verifyJWT(token string) (*Identity, error) {
+	keys, err := loadJWKS()
+	if err != nil {
+		log.Error("Unable to verify JWT", zap.Error(err))
+		return nil, ErrInvalidToken
+	}
+
+	options := []jwt.ParseOption{
+		jwt.WithKeySet(keys, jws.WithInferAlgorithmFromKey(true)),
+		jwt.WithValidate(true),
+		jwt.WithAcceptableSkew(30 * time.Second),
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+	}
+	if issuer := config.AppConfig.Server.Auth.Issuer; issuer != "" {
+		options = append(options, jwt.WithIssuer(issuer))
+	}
+	if audience := config.AppConfig.Server.Auth.Audience; audience != "" {
+		options = append(options, jwt.WithAudience(audience))
+	}
+
+	parsed, err := jwt.ParseString(token, options...)
+	if err != nil {
+		log.Debug("Rejected JWT", zap.Error(err))
+		return nil, ErrInvalidToken
+	}
+
+	var scopes []string
+	if scopeClaim, ok := parsed.Get("scope"); ok {
+		if scopeString, ok := scopeClaim.(string); ok {
+			scopes = strings.Fields(scopeString)
+		}
+	}
+
+	return &Identity{Subject: parsed.Subject(), Method: MethodJWT, Scopes: scopes}, nil
+}
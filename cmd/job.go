@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+	"github.com/pelicanplatform/pelicanobjectstager/logger"
+)
+
+// Connection settings of the daemon targeted by client subcommands
+var (
+	daemonURL      string
+	daemonToken    string
+	daemonCAFile   string
+	clientCertFile string
+	clientKeyFile  string
+)
+
+// newJobCmd builds the subcommands that manage staging jobs on a running daemon
+func newJobCmd() *cobra.Command {
+	var jobCmd = &cobra.Command{
+		Use:   "job",
+		Short: "Manage staging jobs on a running daemon",
+	}
+	jobCmd.PersistentFlags().StringVar(&daemonURL, "server", "", "Base URL of the daemon (defaults to localhost:<server.port>, over HTTPS when server.tls is set)")
+	jobCmd.PersistentFlags().StringVar(&daemonToken, "token", os.Getenv("PELICAN_STAGER_TOKEN"), "Bearer token for the daemon (defaults to $PELICAN_STAGER_TOKEN)")
+	jobCmd.PersistentFlags().StringVar(&daemonCAFile, "ca-file", "", "CA bundle used to verify the daemon's certificate")
+	jobCmd.PersistentFlags().StringVar(&clientCertFile, "cert-file", "", "Client certificate presented to the daemon")
+	jobCmd.PersistentFlags().StringVar(&clientKeyFile, "key-file", "", "Private key of the client certificate")
+
+	var cancelCmd = &cobra.Command{
+		Use:   "cancel <job_id>",
+		Short: "Cancel a staging job and kill its running pelican processes",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			jobID := args[0]
+
+			statusCode, body, err := callDaemon(http.MethodDelete, "/object/jobs/"+jobID)
+			if err != nil {
+				logger.Base().Fatal("Failed to reach the daemon", zap.String("job_id", jobID), zap.Error(err))
+			}
+
+			fmt.Println(body)
+			if statusCode != http.StatusAccepted {
+				logger.Base().Fatal("Failed to cancel staging job",
+					zap.String("job_id", jobID),
+					zap.Int("status", statusCode),
+				)
+			}
+		},
+	}
+
+	jobCmd.AddCommand(cancelCmd)
+	return jobCmd
+}
+
+// callDaemon sends a request to the daemon and returns the status code and response body
+func callDaemon(method, path string) (int, string, error) {
+	baseURL := daemonURL
+	if baseURL == "" {
+		scheme := "http"
+		if config.AppConfig.Server.TLS.CertFile != "" {
+			scheme = "https"
+		}
+		baseURL = scheme + "://localhost:" + strconv.Itoa(config.AppConfig.Server.Port)
+	}
+
+	tlsConfig, err := daemonTLSConfig()
+	if err != nil {
+		return 0, "", err
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(baseURL, "/")+path, nil)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to build request: %v", err)
+	}
+	if daemonToken != "" {
+		req.Header.Set("Authorization", "Bearer "+daemonToken)
+	}
+
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("request to %s failed: %v", req.URL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, "", fmt.Errorf("failed to read response: %v", err)
+	}
+
+	return resp.StatusCode, string(body), nil
+}
+
+// daemonTLSConfig builds the client TLS settings from the connection flags
+func daemonTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if daemonCAFile != "" {
+		caPEM, err := os.ReadFile(daemonCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", daemonCAFile)
+		}
+	}
+
+	if clientCertFile != "" || clientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
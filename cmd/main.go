@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"os"
+
 	"go.uber.org/zap"
 
 	"github.com/pelicanplatform/pelicanobjectstager/config"
@@ -24,6 +27,7 @@ func main() {
 		Short: "Start the github.com/pelicanplatform/pelicanobjectstager daemon",
 		Run: func(cmd *cobra.Command, args []string) {
 			logger.Base().Info("Starting pelicanobjectstager daemon...")
+			db.InitializeDB()
 			server.StartServer()
 		},
 	}
@@ -31,15 +35,21 @@ func main() {
 	// Subcommand to invoke PelicanBinary
 	var pelicanCmd = &cobra.Command{
 		Use:   "pelican [args...]",
-		Short: "Invoke the PelicanBinary with the given arguments",
+		Short: "Invoke the PelicanBinary with the given arguments, passing its output through",
 		Args:  cobra.ArbitraryArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			stdout, stderr, exitCode, err := pelican.InvokePelicanBinary(args)
+			if violation := pelican.CheckPassthroughArgs(args); violation != nil {
+				logger.Base().Fatal("PelicanBinary call rejected by policy", zap.Strings("args", args), zap.Error(violation))
+			}
+
+			// Pass the output through live; it is not repeated in the log afterwards
+			_, _, exitCode, err := pelican.InvokePelicanOperationStreaming(context.Background(), pelican.OperationForArgs(args), args, pelican.StreamHandlers{
+				Stdout: os.Stdout,
+				Stderr: os.Stderr,
+			})
 
 			// Consolidated logging
 			logger.Base().Info("PelicanBinary execution details",
-				zap.String("stdout", stdout),
-				zap.String("stderr", stderr),
 				zap.Int("pelican_client_exit_code", exitCode),
 				zap.Error(err),
 			)
@@ -54,10 +64,11 @@ func main() {
 
 	rootCmd.AddCommand(serverCmd)
 	rootCmd.AddCommand(pelicanCmd)
+	rootCmd.AddCommand(newJobCmd())
+	rootCmd.AddCommand(newMigrateCmd())
 
 	cobra.OnInitialize(func() {
 		config.LoadConfig("/etc/pelican/config.yaml")
-		db.InitializeDB()
 	})
 
 	if err := rootCmd.Execute(); err != nil {
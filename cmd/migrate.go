@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/db"
+	"github.com/pelicanplatform/pelicanobjectstager/logger"
+)
+
+// newMigrateCmd builds the subcommands that manage the database schema
+func newMigrateCmd() *cobra.Command {
+	var migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage the database schema version",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			db.ConnectDB()
+		},
+	}
+
+	var target uint
+	var upCmd = &cobra.Command{
+		Use:   "up",
+		Short: "Apply pending migrations",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			applied, err := db.MigrateUp(target)
+			for _, migration := range applied {
+				fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+			}
+			if err != nil {
+				logger.Base().Fatal("Failed to migrate the database", zap.Error(err))
+			}
+			if len(applied) == 0 {
+				fmt.Println("Database schema is up to date")
+			}
+		},
+	}
+	upCmd.Flags().UintVar(&target, "to", 0, "Version to migrate to (defaults to the latest)")
+
+	var steps int
+	var downCmd = &cobra.Command{
+		Use:   "down",
+		Short: "Revert the most recent migrations",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if steps < 1 {
+				logger.Base().Fatal("--steps must be at least 1", zap.Int("steps", steps))
+			}
+
+			reverted, err := db.MigrateDown(steps)
+			for _, migration := range reverted {
+				fmt.Printf("Reverted %04d_%s\n", migration.Version, migration.Name)
+			}
+			if err != nil {
+				logger.Base().Fatal("Failed to revert migrations", zap.Error(err))
+			}
+			if len(reverted) == 0 {
+				fmt.Println("No migrations to revert")
+			}
+		},
+	}
+	downCmd.Flags().IntVar(&steps, "steps", 1, "Number of migrations to revert")
+
+	var statusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "List the migrations and whether they are applied",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			states, err := db.MigrationStatus()
+			if err != nil {
+				logger.Base().Fatal("Failed to read the migration status", zap.Error(err))
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+			for _, state := range states {
+				status, appliedAt := "pending", ""
+				if state.AppliedAt != nil {
+					status, appliedAt = "applied", state.AppliedAt.Format(time.RFC3339)
+				}
+				if state.Unknown {
+					status = "unknown (newer release)"
+				}
+				fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", state.Version, state.Name, status, appliedAt)
+			}
+			w.Flush()
+		},
+	}
+
+	migrateCmd.AddCommand(upCmd, downCmd, statusCmd)
+	return migrateCmd
+}
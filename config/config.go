@@ -4,6 +4,7 @@ import (
 	"bytes"
 	_ "embed"
 	"encoding/json"
+	"fmt"
 	"os"
 	"time"
 
@@ -15,22 +16,111 @@ import (
 // Initialize the zap logger for the "config" component
 var log = logger.With(zap.String("component", "config"))
 
+// StaticToken is a pre-shared bearer token and the scopes it grants
+type StaticToken struct {
+	Name   string   `mapstructure:"name"`
+	Token  string   `mapstructure:"token" json:"-"` // Never logged
+	Scopes []string `mapstructure:"scopes"`
+}
+
+// CacheLimit caps the entries staged concurrently to one target cache
+type CacheLimit struct {
+	Cache         string `mapstructure:"cache"`
+	MaxConcurrent int    `mapstructure:"max_concurrent"`
+}
+
 type Config struct {
 	Server struct {
 		Port int `mapstructure:"port"`
+
+		TLS struct {
+			CertFile     string `mapstructure:"cert_file"`
+			KeyFile      string `mapstructure:"key_file"`
+			ClientCAFile string `mapstructure:"client_ca_file"` // Requires and verifies client certificates when set
+		} `mapstructure:"tls"`
+
+		Auth struct {
+			Enabled          bool          `mapstructure:"enabled"`
+			Tokens           []StaticToken `mapstructure:"tokens"`
+			ClientCertScopes []string      `mapstructure:"client_cert_scopes"` // Scopes granted to verified client certificates
+			JWKSFile         string        `mapstructure:"jwks_file"`          // Local JWKS used to verify JWT bearer tokens
+			Issuer           string        `mapstructure:"issuer"`             // Required "iss" claim of JWTs, if set
+			Audience         string        `mapstructure:"audience"`           // Required "aud" claim of JWTs, if set
+		} `mapstructure:"auth"`
 	} `mapstructure:"server"`
 
 	Pelican struct {
 		BinaryPath string `mapstructure:"binary_path"`
+
+		// Default deadlines per operation type; zero disables the deadline
+		Timeouts struct {
+			Health    time.Duration `mapstructure:"health"`
+			ObjectGet time.Duration `mapstructure:"object_get"`
+			Stat      time.Duration `mapstructure:"stat"`
+			Default   time.Duration `mapstructure:"default"`
+		} `mapstructure:"timeouts"`
+
+		// Policy applied to raw invocations from POST /pelican and the pelican subcommand
+		Passthrough struct {
+			AllowedSubcommands []string `mapstructure:"allowed_subcommands"` // Leading arguments a call must start with, e.g. "object stat"
+			ForbiddenFlags     []string `mapstructure:"forbidden_flags"`
+			MaxArgs            int      `mapstructure:"max_args"`
+			AllowLocalPaths    bool     `mapstructure:"allow_local_paths"` // Accept arguments that look like local filesystem paths
+		} `mapstructure:"passthrough"`
 	} `mapstructure:"pelican"`
 
 	Staging struct {
-		TempDestination string `mapstructure:"temp_destination"`
-		Workers         int    `mapstructure:"workers"`
+		TempDestination   string        `mapstructure:"temp_destination"`
+		Workers           int           `mapstructure:"workers"`             // Daemon-wide maximum of entries staged concurrently
+		InstanceID        string        `mapstructure:"instance_id"`         // Owner of the entries this daemon runs, defaults to the hostname
+		QueuePollInterval time.Duration `mapstructure:"queue_poll_interval"` // How often idle workers re-check the staging queue
+		DrainTimeout      time.Duration `mapstructure:"drain_timeout"`       // How long running entries may finish on shutdown before they are killed
+		LeaseDuration     time.Duration `mapstructure:"lease_duration"`      // How long a running entry stays claimed without being renewed
+
+		CacheLimits       []CacheLimit `mapstructure:"cache_limits"`
+		DefaultCacheLimit int          `mapstructure:"default_cache_limit"` // Cap of caches missing from cache_limits; zero means none
+
+		// Share of the entries dispatched to each priority class while several have work
+		PriorityWeights struct {
+			High   int `mapstructure:"high"`
+			Normal int `mapstructure:"normal"`
+			Bulk   int `mapstructure:"bulk"`
+		} `mapstructure:"priority_weights"`
+
+		TempCleanupInterval time.Duration `mapstructure:"temp_cleanup_interval"` // How often orphaned temp files are swept; 0 disables the sweep
+		TempMaxAge          time.Duration `mapstructure:"temp_max_age"`          // Age after which an orphaned temp file is removed
+
+		// Retry policy for entries failing with a transient error
+		Retry struct {
+			MaxAttempts             int           `mapstructure:"max_attempts"` // Total attempts including the first one
+			BaseDelay               time.Duration `mapstructure:"base_delay"`
+			MaxDelay                time.Duration `mapstructure:"max_delay"`
+			Jitter                  float64       `mapstructure:"jitter"`                // Fraction of the delay randomized, between 0 and 1
+			TransientErrorCodes     []string      `mapstructure:"transient_error_codes"` // Failure categories, see pelican.ErrorCode
+			TransientExitCodes      []int         `mapstructure:"transient_exit_codes"`
+			TransientStderrPatterns []string      `mapstructure:"transient_stderr_patterns"` // Case-insensitive regular expressions
+		} `mapstructure:"retry"`
 	}
 
+	// Notifications sent when a staging job finishes
+	Webhooks struct {
+		URLs        []string      `mapstructure:"urls"`            // Notified for every job, in addition to its callback_url
+		Secret      string        `mapstructure:"secret" json:"-"` // HMAC-SHA256 key signing the payloads; never logged
+		Timeout     time.Duration `mapstructure:"timeout"`         // Per-attempt request timeout
+		MaxAttempts int           `mapstructure:"max_attempts"`    // Total attempts including the first one
+		BaseDelay   time.Duration `mapstructure:"base_delay"`
+		MaxDelay    time.Duration `mapstructure:"max_delay"`
+
+		CallbackHosts         []string `mapstructure:"callback_hosts"`          // Hosts a job's callback_url may target, e.g. "*.example.org"; empty allows any public host
+		AllowPrivateCallbacks bool     `mapstructure:"allow_private_callbacks"` // Let callback_url reach loopback, link-local and private addresses
+	} `mapstructure:"webhooks"`
+
 	Database struct {
-		Location               string        `mapstructure:"location"`
+		Driver                 string        `mapstructure:"driver"`       // sqlite or postgres
+		Location               string        `mapstructure:"location"`     // Database file of the sqlite driver
+		DSN                    string        `mapstructure:"dsn" json:"-"` // Connection string of the postgres driver; never logged
+		BusyTimeout            time.Duration `mapstructure:"busy_timeout"` // How long sqlite waits for a lock held by another connection
+		AutoMigrate            bool          `mapstructure:"auto_migrate"` // Apply pending schema migrations when the daemon starts
 		RefreshInterval        time.Duration `mapstructure:"refresh_interval"`
 		MaxRecordStaleDuration time.Duration `mapstructure:"max_record_stale_duration"`
 	} `mapstructure:"database"`
@@ -69,6 +159,10 @@ func LoadConfig(configPath string) {
 		log.Fatal("Unable to decode configuration", zap.Error(err))
 	}
 
+	if err := validateConfig(); err != nil {
+		log.Fatal("Invalid configuration", zap.Error(err))
+	}
+
 	// Serialize the final configuration for logging
 	configBytes, err := json.MarshalIndent(AppConfig, "", "  ")
 	if err != nil {
@@ -79,3 +173,26 @@ func LoadConfig(configPath string) {
 
 	log.Info("Configuration loading complete")
 }
+
+// validateConfig rejects settings that would make the daemon misbehave at runtime
+func validateConfig() error {
+	if AppConfig.Staging.Workers <= 0 {
+		return fmt.Errorf("staging.workers must be positive, got %d", AppConfig.Staging.Workers)
+	}
+	if AppConfig.Staging.QueuePollInterval <= 0 {
+		return fmt.Errorf("staging.queue_poll_interval must be positive, got %s", AppConfig.Staging.QueuePollInterval)
+	}
+	if AppConfig.Staging.LeaseDuration < time.Second {
+		return fmt.Errorf("staging.lease_duration must be at least 1s, got %s", AppConfig.Staging.LeaseDuration)
+	}
+
+	// A partial TLS setup would silently serve plain HTTP
+	tls := AppConfig.Server.TLS
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		return fmt.Errorf("server.tls.cert_file and server.tls.key_file must be set together")
+	}
+	if tls.ClientCAFile != "" && tls.CertFile == "" {
+		return fmt.Errorf("server.tls.client_ca_file requires server.tls.cert_file and server.tls.key_file")
+	}
+	return nil
+}
@@ -3,9 +3,11 @@ package db
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
@@ -39,31 +41,73 @@ var (
 	log = logger.With(zap.String("component", "database"))
 )
 
-// Initialize sets up the database connection and runs migrations.
-func InitializeDB() {
+// Supported values of database.driver
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// ConnectDB opens the database connection without touching the schema.
+func ConnectDB() {
 	// Attempt to connect to the database
-	var err error
-	databaseLocation := config.AppConfig.Database.Location
-	DB, err = gorm.Open(sqlite.Open(databaseLocation), &gorm.Config{})
+	dialector, err := openDialector()
+	if err != nil {
+		log.Fatal("Invalid database configuration", zap.Error(err))
+		return
+	}
+	DB, err = gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
 		log.Fatal("Failed to connect to the database", zap.Error(err))
 		return
 	}
-	log.Info("Database connection established", zap.String("location", databaseLocation))
+	log.Info("Database connection established",
+		zap.String("driver", dialector.Name()),
+		zap.String("location", config.AppConfig.Database.Location),
+	)
+}
 
-	// Run migrations
-	err = DB.AutoMigrate(&StagingRecord{})
+// InitializeDB sets up the database connection and brings the schema up to date. It
+// refuses to continue with a schema written by a newer release.
+func InitializeDB() {
+	ConnectDB()
+
+	current, latest, err := SchemaVersion()
 	if err != nil {
+		log.Fatal("Failed to read the database schema version", zap.Error(err))
+		return
+	}
+	if current > latest {
+		log.Fatal("Database schema is newer than this build supports; upgrade the daemon or run migrate down with the newer release",
+			zap.Uint("schema_version", current),
+			zap.Uint("latest_known_version", latest),
+		)
+		return
+	}
+	if current == latest {
+		log.Info("Database schema is up to date", zap.Uint("schema_version", current))
+		return
+	}
+
+	if !config.AppConfig.Database.AutoMigrate {
+		log.Fatal("Database schema is out of date; run migrate up",
+			zap.Uint("schema_version", current),
+			zap.Uint("latest_known_version", latest),
+		)
+		return
+	}
+	if _, err := MigrateUp(0); err != nil {
 		log.Fatal("Failed to migrate database", zap.Error(err))
 		return
 	}
-	log.Info("Database migration completed")
+	log.Info("Database migration completed", zap.Uint("schema_version", latest))
 }
 
-func InsertOrUpdateStagingRecord(pelicanURL, stagingStorage, jobID string, objectSize int64, exitCode int, stdout, stderr string) error {
+// insertOrUpdateStagingRecord stores the outcome of staging an object to a staging storage,
+// replacing the previous record of the pair if any.
+func insertOrUpdateStagingRecord(tx *gorm.DB, pelicanURL, stagingStorage, jobID string, objectSize int64, exitCode int, stdout, stderr string) error {
 	// Check if the record with the given combination already exists
 	var existingRecord StagingRecord
-	err := DB.Where("pelican_url = ? AND staging_storage = ?", pelicanURL, stagingStorage).First(&existingRecord).Error
+	err := tx.Where("pelican_url = ? AND staging_storage = ?", pelicanURL, stagingStorage).First(&existingRecord).Error
 
 	if err == nil {
 		// Record exists, update it
@@ -73,7 +117,7 @@ func InsertOrUpdateStagingRecord(pelicanURL, stagingStorage, jobID string, objec
 		existingRecord.PelicanStdout = stdout
 		existingRecord.PelicanStderr = stderr
 
-		if updateErr := DB.Save(&existingRecord).Error; updateErr != nil {
+		if updateErr := tx.Save(&existingRecord).Error; updateErr != nil {
 			return fmt.Errorf("failed to update record: %v", updateErr)
 		}
 	} else if err == gorm.ErrRecordNotFound {
@@ -88,7 +132,7 @@ func InsertOrUpdateStagingRecord(pelicanURL, stagingStorage, jobID string, objec
 			PelicanStderr:   stderr,
 		}
 
-		if createErr := DB.Create(&newRecord).Error; createErr != nil {
+		if createErr := tx.Create(&newRecord).Error; createErr != nil {
 			return fmt.Errorf("failed to create new record: %v", createErr)
 		}
 	} else {
@@ -99,18 +143,6 @@ func InsertOrUpdateStagingRecord(pelicanURL, stagingStorage, jobID string, objec
 	return nil
 }
 
-func GetStagingRecordLites() ([]StagingRecordLite, error) {
-	var records []StagingRecordLite
-
-	// GORM will automatically map fields in StagingRecordLite to database columns
-	err := DB.Model(&StagingRecord{}).Find(&records).Error
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve staging record lites: %v", err)
-	}
-
-	return records, nil
-}
-
 func GetStagingStorageSizeMap() (map[string]int64, error) {
 	type Result struct {
 		StagingStorage string
@@ -136,6 +168,46 @@ func GetStagingStorageSizeMap() (map[string]int64, error) {
 	return storageSizeMap, nil
 }
 
+// GetFreshStagingRecord returns the record for the URL and staging storage if it was
+// updated within maxAge, or nil otherwise.
+func GetFreshStagingRecord(pelicanURL, stagingStorage string, maxAge time.Duration) (*StagingRecord, error) {
+	var record StagingRecord
+
+	cutoffTime := time.Now().Add(-maxAge)
+	err := DB.Where("pelican_url = ? AND staging_storage = ? AND updated_at >= ?", pelicanURL, stagingStorage, cutoffTime).
+		First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to look up staging record for %s: %v", pelicanURL, err)
+	}
+
+	return &record, nil
+}
+
+// StagingStorageStats summarizes the records held by one staging storage
+type StagingStorageStats struct {
+	StagingStorage string
+	RecordCount    int64
+	TotalSize      int64
+}
+
+func GetStagingStorageStats() ([]StagingStorageStats, error) {
+	var stats []StagingStorageStats
+
+	err := DB.Model(&StagingRecord{}).
+		Select("staging_storage, COUNT(*) as record_count, SUM(object_size) as total_size").
+		Group("staging_storage").
+		Scan(&stats).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate storage stats: %v", err)
+	}
+
+	return stats, nil
+}
+
 func GetStagingRecordByID(id uint) (*StagingRecord, error) {
 	var record StagingRecord
 
@@ -149,3 +221,41 @@ func GetStagingRecordByID(id uint) (*StagingRecord, error) {
 
 	return &record, nil
 }
+
+// openDialector selects the database driver and its connection settings. SQLite runs in
+// WAL mode so that readers do not block the workers' writes, waits for locks up to
+// database.busy_timeout and takes the write lock when a transaction starts, which
+// keeps concurrent claims from failing on lock upgrades.
+func openDialector() (gorm.Dialector, error) {
+	settings := config.AppConfig.Database
+
+	switch settings.Driver {
+	case DriverSQLite, "":
+		separator := "?"
+		if strings.Contains(settings.Location, "?") {
+			separator = "&"
+		}
+		dsn := fmt.Sprintf("%s%s_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate",
+			settings.Location, separator, settings.BusyTimeout.Milliseconds())
+		return sqlite.Open(dsn), nil
+	case DriverPostgres:
+		if settings.DSN == "" {
+			return nil, fmt.Errorf("database.dsn is required by the %s driver", DriverPostgres)
+		}
+		return postgres.Open(settings.DSN), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", settings.Driver)
+	}
+}
+
+// CloseDB closes the underlying database connection.
+func CloseDB() error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get database handle: %v", err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		return fmt.Errorf("failed to close database: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,645 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+)
+
+// postgresDSNVariable names the environment variable holding the connection string of a
+// scratch PostgreSQL database. The PostgreSQL runs are skipped when it is unset; every
+// table of that database is dropped by the tests.
+const postgresDSNVariable = "PELICAN_STAGER_TEST_POSTGRES_DSN"
+
+const testCache = "https://cache.example.org:8443"
+
+func TestMain(m *testing.M) {
+	config.AppConfig.Database.BusyTimeout = 5 * time.Second
+	config.AppConfig.Staging.InstanceID = "test-instance"
+	config.AppConfig.Staging.LeaseDuration = time.Minute
+	os.Exit(m.Run())
+}
+
+// forEachDriver runs the test against a freshly migrated SQLite database, and against
+// PostgreSQL when a DSN is configured
+func forEachDriver(t *testing.T, test func(t *testing.T)) {
+	t.Run(DriverSQLite, func(t *testing.T) {
+		config.AppConfig.Database.Driver = DriverSQLite
+		config.AppConfig.Database.Location = filepath.Join(t.TempDir(), "stager.sqlite")
+		openTestDB(t)
+		test(t)
+	})
+
+	t.Run(DriverPostgres, func(t *testing.T) {
+		dsn := os.Getenv(postgresDSNVariable)
+		if dsn == "" {
+			t.Skipf("%s is not set", postgresDSNVariable)
+		}
+		config.AppConfig.Database.Driver = DriverPostgres
+		config.AppConfig.Database.DSN = dsn
+		openTestDB(t)
+		test(t)
+	})
+}
+
+// openTestDB connects to the configured database and migrates it from scratch
+func openTestDB(t *testing.T) {
+	t.Helper()
+
+	ConnectDB()
+	t.Cleanup(func() {
+		if _, err := MigrateDown(len(mustLoadMigrations(t))); err != nil {
+			t.Errorf("failed to clean up the database: %v", err)
+		}
+		if err := CloseDB(); err != nil {
+			t.Errorf("failed to close the database: %v", err)
+		}
+	})
+
+	// A previous run may have left its tables behind on a shared database
+	if _, err := MigrateDown(len(mustLoadMigrations(t))); err != nil {
+		t.Fatalf("failed to reset the database: %v", err)
+	}
+	if _, err := MigrateUp(0); err != nil {
+		t.Fatalf("failed to migrate the database: %v", err)
+	}
+}
+
+func mustLoadMigrations(t *testing.T) []Migration {
+	t.Helper()
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	return migrations
+}
+
+// createTestJob persists a queued job with one entry per request URL
+func createTestJob(t *testing.T, jobID string, requestURLs ...string) *StagingJob {
+	t.Helper()
+
+	job := StagingJob{
+		ID:           jobID,
+		TargetCache:  testCache,
+		Mode:         "download",
+		Priority:     PriorityNormal,
+		State:        StateQueued,
+		TotalEntries: len(requestURLs),
+	}
+	for _, requestURL := range requestURLs {
+		job.Entries = append(job.Entries, StagingJobEntry{
+			TargetCache: testCache,
+			RequestURL:  requestURL,
+			Mode:        "download",
+			Priority:    PriorityNormal,
+			State:       StateQueued,
+		})
+	}
+	if err := CreateStagingJob(&job); err != nil {
+		t.Fatalf("CreateStagingJob: %v", err)
+	}
+	return &job
+}
+
+// claimTestEntry claims the next queued entry of the test cache and fails if there is none
+func claimTestEntry(t *testing.T) *StagingJobEntry {
+	t.Helper()
+
+	entry, err := ClaimNextQueuedEntry(PriorityNormal, testCache)
+	if err != nil {
+		t.Fatalf("ClaimNextQueuedEntry: %v", err)
+	}
+	if entry == nil {
+		t.Fatal("ClaimNextQueuedEntry found nothing to claim")
+	}
+	return entry
+}
+
+func getTestEntry(t *testing.T, entryID uint) StagingJobEntry {
+	t.Helper()
+
+	var entry StagingJobEntry
+	if err := DB.First(&entry, entryID).Error; err != nil {
+		t.Fatalf("failed to read entry %d: %v", entryID, err)
+	}
+	return entry
+}
+
+func TestMigrations(t *testing.T) {
+	forEachDriver(t, func(t *testing.T) {
+		latest := uint(len(mustLoadMigrations(t)))
+
+		current, known, err := SchemaVersion()
+		if err != nil {
+			t.Fatalf("SchemaVersion: %v", err)
+		}
+		if current != latest || known != latest {
+			t.Fatalf("schema at version %d of %d, want %d", current, known, latest)
+		}
+		if !DB.Migrator().HasColumn(&StagingJobEntry{}, "lease_expires_at") {
+			t.Error("staging_job_entries has no lease_expires_at column")
+		}
+
+		reverted, err := MigrateDown(int(latest))
+		if err != nil {
+			t.Fatalf("MigrateDown: %v", err)
+		}
+		if len(reverted) != int(latest) {
+			t.Errorf("reverted %d migrations, want %d", len(reverted), latest)
+		}
+		for _, table := range []string{"staging_records", "staging_jobs", "staging_job_entries", "webhook_deliveries"} {
+			if DB.Migrator().HasTable(table) {
+				t.Errorf("table %s still exists after migrating down", table)
+			}
+		}
+
+		if _, err := MigrateUp(2); err != nil {
+			t.Fatalf("MigrateUp(2): %v", err)
+		}
+		if current, _, _ := SchemaVersion(); current != 2 {
+			t.Errorf("schema at version %d after MigrateUp(2)", current)
+		}
+		if _, err := MigrateUp(0); err != nil {
+			t.Fatalf("MigrateUp(0): %v", err)
+		}
+		if current, _, _ := SchemaVersion(); current != latest {
+			t.Errorf("schema at version %d after MigrateUp(0), want %d", current, latest)
+		}
+	})
+}
+
+func TestClaimAndFinishJob(t *testing.T) {
+	forEachDriver(t, func(t *testing.T) {
+		job := createTestJob(t, "job-claim", "pelican://origin/a", "pelican://origin/b")
+
+		first := claimTestEntry(t)
+		if first.ID != job.Entries[0].ID {
+			t.Errorf("claimed entry %d, want the oldest entry %d", first.ID, job.Entries[0].ID)
+		}
+		stored := getTestEntry(t, first.ID)
+		if stored.State != StateRunning || stored.Attempts != 1 || stored.ClaimedBy != "test-instance" {
+			t.Errorf("claimed entry is %s with %d attempts by %q", stored.State, stored.Attempts, stored.ClaimedBy)
+		}
+		if stored.LeaseExpiresAt == nil || !stored.LeaseExpiresAt.After(time.Now()) {
+			t.Errorf("claimed entry has lease %v, want one in the future", stored.LeaseExpiresAt)
+		}
+
+		if err := FinishStagingJobEntry(first.ID, StateSucceeded, 42, 0, "", ""); err != nil {
+			t.Fatalf("FinishStagingJobEntry: %v", err)
+		}
+		if state, err := FinishStagingJobIfDone(job.ID); err != nil || state != "" {
+			t.Fatalf("FinishStagingJobIfDone with a queued entry = %q, %v", state, err)
+		}
+
+		second := claimTestEntry(t)
+		if err := FinishStagingJobEntry(second.ID, StateFailed, 0, 1, "not_found", "404"); err != nil {
+			t.Fatalf("FinishStagingJobEntry: %v", err)
+		}
+		if state, err := FinishStagingJobIfDone(job.ID); err != nil || state != StateFailed {
+			t.Fatalf("FinishStagingJobIfDone = %q, %v, want %q", state, err, StateFailed)
+		}
+		if state, err := FinishStagingJobIfDone(job.ID); err != nil || state != "" {
+			t.Errorf("FinishStagingJobIfDone on a finished job = %q, %v, want no state", state, err)
+		}
+
+		if entry, err := ClaimNextQueuedEntry(PriorityNormal, testCache); err != nil || entry != nil {
+			t.Errorf("ClaimNextQueuedEntry on an empty queue = %v, %v", entry, err)
+		}
+	})
+}
+
+func TestFinishStagingJobIfDoneReportsOnce(t *testing.T) {
+	forEachDriver(t, func(t *testing.T) {
+		job := createTestJob(t, "job-finish-once", "pelican://origin/a")
+		entry := claimTestEntry(t)
+		if err := FinishStagingJobEntry(entry.ID, StateSucceeded, 1, 0, "", ""); err != nil {
+			t.Fatalf("FinishStagingJobEntry: %v", err)
+		}
+
+		const callers = 8
+		states := make(chan string, callers)
+		var wg sync.WaitGroup
+		for i := 0; i < callers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				state, err := FinishStagingJobIfDone(job.ID)
+				if err != nil {
+					t.Errorf("FinishStagingJobIfDone: %v", err)
+				}
+				states <- state
+			}()
+		}
+		wg.Wait()
+		close(states)
+
+		reported := 0
+		for state := range states {
+			if state != "" {
+				reported++
+			}
+		}
+		if reported != 1 {
+			t.Errorf("%d callers were told they finished the job, want 1", reported)
+		}
+	})
+}
+
+func TestEntryLeases(t *testing.T) {
+	forEachDriver(t, func(t *testing.T) {
+		createTestJob(t, "job-lease", "pelican://origin/a", "pelican://origin/b")
+		held := claimTestEntry(t)
+		lost := claimTestEntry(t)
+
+		// Another instance took over the second entry
+		if err := DB.Model(&StagingJobEntry{}).Where("id = ?", lost.ID).Update("claimed_by", "other-instance").Error; err != nil {
+			t.Fatalf("failed to reassign entry: %v", err)
+		}
+		renewed, err := RenewEntryLeases([]uint{held.ID, lost.ID})
+		if err != nil {
+			t.Fatalf("RenewEntryLeases: %v", err)
+		}
+		if len(renewed) != 1 || renewed[0] != held.ID {
+			t.Errorf("RenewEntryLeases renewed %v, want only entry %d", renewed, held.ID)
+		}
+
+		if requeued, err := RequeueExpiredEntries(); err != nil || requeued != 0 {
+			t.Fatalf("RequeueExpiredEntries with live leases = %d, %v", requeued, err)
+		}
+
+		expired := time.Now().Add(-time.Second)
+		if err := DB.Model(&StagingJobEntry{}).Where("id = ?", lost.ID).Update("lease_expires_at", expired).Error; err != nil {
+			t.Fatalf("failed to expire lease: %v", err)
+		}
+		if requeued, err := RequeueExpiredEntries(); err != nil || requeued != 1 {
+			t.Fatalf("RequeueExpiredEntries = %d, %v, want 1", requeued, err)
+		}
+
+		stored := getTestEntry(t, lost.ID)
+		if stored.State != StateQueued || stored.Attempts != 0 || stored.LeaseExpiresAt != nil {
+			t.Errorf("requeued entry is %s with %d attempts and lease %v", stored.State, stored.Attempts, stored.LeaseExpiresAt)
+		}
+		if stored := getTestEntry(t, held.ID); stored.State != StateRunning {
+			t.Errorf("entry with a live lease is %s, want %s", stored.State, StateRunning)
+		}
+	})
+}
+
+func TestLostClaim(t *testing.T) {
+	forEachDriver(t, func(t *testing.T) {
+		createTestJob(t, "job-lost-claim", "pelican://origin/a")
+		entry := claimTestEntry(t)
+
+		// The lease expired and another instance claimed the entry again
+		if err := DB.Model(&StagingJobEntry{}).Where("id = ?", entry.ID).Update("claimed_by", "other-instance").Error; err != nil {
+			t.Fatalf("failed to reassign entry: %v", err)
+		}
+
+		if err := FinishStagedEntry(*entry, 42, 0, "", ""); !errors.Is(err, ErrEntryNotClaimed) {
+			t.Errorf("FinishStagedEntry = %v, want ErrEntryNotClaimed", err)
+		}
+		if err := FinishStagingJobEntry(entry.ID, StateFailed, 0, 1, "", ""); !errors.Is(err, ErrEntryNotClaimed) {
+			t.Errorf("FinishStagingJobEntry = %v, want ErrEntryNotClaimed", err)
+		}
+		if err := RequeueEntryForRetry(entry.ID, time.Now(), "timeout", ""); !errors.Is(err, ErrEntryNotClaimed) {
+			t.Errorf("RequeueEntryForRetry = %v, want ErrEntryNotClaimed", err)
+		}
+		if err := RequeueInterruptedEntry(entry.ID); !errors.Is(err, ErrEntryNotClaimed) {
+			t.Errorf("RequeueInterruptedEntry = %v, want ErrEntryNotClaimed", err)
+		}
+
+		if stored := getTestEntry(t, entry.ID); stored.State != StateRunning || stored.ClaimedBy != "other-instance" {
+			t.Errorf("entry is %s under %q, want it left running under the new owner", stored.State, stored.ClaimedBy)
+		}
+		var records int64
+		if err := DB.Model(&StagingRecord{}).Count(&records).Error; err != nil || records != 0 {
+			t.Errorf("found %d staging records (%v), want none", records, err)
+		}
+	})
+}
+
+func TestWebhookDeliveryClaims(t *testing.T) {
+	forEachDriver(t, func(t *testing.T) {
+		delivery := WebhookDelivery{JobID: "job-webhook", URL: "https://hooks.example.org", State: DeliveryPending}
+		if err := CreateWebhookDelivery(&delivery); err != nil {
+			t.Fatalf("CreateWebhookDelivery: %v", err)
+		}
+
+		claimed, err := ClaimWebhookDelivery(delivery.ID, time.Minute)
+		if err != nil || claimed == nil || claimed.ClaimedBy != instanceID() {
+			t.Fatalf("ClaimWebhookDelivery = %+v, %v, want it claimed by this instance", claimed, err)
+		}
+		if pending, err := GetPendingWebhookDeliveries(); err != nil || len(pending) != 0 {
+			t.Errorf("GetPendingWebhookDeliveries = %d deliveries, %v, want none while claimed", len(pending), err)
+		}
+
+		// Another instance holds an unexpired claim
+		if err := DB.Model(&WebhookDelivery{}).Where("id = ?", delivery.ID).Update("claimed_by", "other-instance").Error; err != nil {
+			t.Fatalf("failed to reassign delivery: %v", err)
+		}
+		if claimed, err := ClaimWebhookDelivery(delivery.ID, time.Minute); err != nil || claimed != nil {
+			t.Errorf("ClaimWebhookDelivery = %+v, %v, want nil while another instance holds it", claimed, err)
+		}
+		err = RecordWebhookAttempt(delivery.ID, DeliveryDelivered, 200, "", nil)
+		if !errors.Is(err, ErrDeliveryNotClaimed) {
+			t.Errorf("RecordWebhookAttempt = %v, want ErrDeliveryNotClaimed", err)
+		}
+
+		// Its claim expired
+		expired := time.Now().Add(-time.Second)
+		if err := DB.Model(&WebhookDelivery{}).Where("id = ?", delivery.ID).Update("lease_expires_at", expired).Error; err != nil {
+			t.Fatalf("failed to expire claim: %v", err)
+		}
+		if claimed, err := ClaimWebhookDelivery(delivery.ID, time.Minute); err != nil || claimed == nil {
+			t.Fatalf("ClaimWebhookDelivery = %+v, %v, want the expired claim taken over", claimed, err)
+		}
+		if err := RecordWebhookAttempt(delivery.ID, DeliveryDelivered, 200, "", nil); err != nil {
+			t.Fatalf("RecordWebhookAttempt: %v", err)
+		}
+
+		stored, err := GetWebhookDeliveryByID(delivery.ID)
+		if err != nil || stored.State != DeliveryDelivered || stored.Attempts != 1 || stored.LeaseExpiresAt != nil {
+			t.Errorf("delivery is %+v (%v), want delivered after 1 attempt without a claim", stored, err)
+		}
+		if claimed, err := ClaimWebhookDelivery(delivery.ID, time.Minute); err != nil || claimed != nil {
+			t.Errorf("ClaimWebhookDelivery = %+v, %v, want nil once delivered", claimed, err)
+		}
+	})
+}
+
+func TestCancelQueuedEntries(t *testing.T) {
+	forEachDriver(t, func(t *testing.T) {
+		job := createTestJob(t, "job-cancel", "pelican://origin/a", "pelican://origin/b")
+		running := claimTestEntry(t)
+
+		cancelled, err := CancelQueuedEntries(job.ID)
+		if err != nil || cancelled != 1 {
+			t.Fatalf("CancelQueuedEntries = %d, %v, want 1", cancelled, err)
+		}
+		if count, err := CountRunningEntries(job.ID); err != nil || count != 1 {
+			t.Errorf("CountRunningEntries = %d, %v, want 1", count, err)
+		}
+
+		jobIDs, err := GetCancelRequestedJobIDs([]string{job.ID, "job-unknown"})
+		if err != nil || len(jobIDs) != 1 || jobIDs[0] != job.ID {
+			t.Errorf("GetCancelRequestedJobIDs = %v, %v, want [%s]", jobIDs, err, job.ID)
+		}
+
+		if err := FinishStagingJobEntry(running.ID, StateCancelled, 0, -1, "", "Cancelled while staging"); err != nil {
+			t.Fatalf("FinishStagingJobEntry: %v", err)
+		}
+		if state, err := FinishStagingJobIfDone(job.ID); err != nil || state != StateCancelled {
+			t.Errorf("FinishStagingJobIfDone = %q, %v, want %q", state, err, StateCancelled)
+		}
+	})
+}
+
+func TestAttachDuplicateEntries(t *testing.T) {
+	forEachDriver(t, func(t *testing.T) {
+		createTestJob(t, "job-leader", "pelican://origin/a")
+
+		job := StagingJob{ID: "job-duplicates", TargetCache: testCache, Priority: PriorityNormal, State: StateQueued}
+		for _, parameters := range []string{"", "--recursive"} {
+			job.Entries = append(job.Entries, StagingJobEntry{
+				TargetCache: testCache,
+				RequestURL:  "pelican://origin/a",
+				Parameters:  parameters,
+				Mode:        "download",
+				Priority:    PriorityNormal,
+				State:       StateQueued,
+			})
+		}
+		if err := CreateStagingJob(&job); err != nil {
+			t.Fatalf("CreateStagingJob: %v", err)
+		}
+
+		if job.Entries[0].AttachedTo == nil {
+			t.Error("entry staging the same object the same way was not attached")
+		}
+		if job.Entries[1].AttachedTo != nil {
+			t.Errorf("entry with different parameters was attached to entry %d", *job.Entries[1].AttachedTo)
+		}
+	})
+}
+
+func TestLeaderFinishingDuringAttach(t *testing.T) {
+	forEachDriver(t, func(t *testing.T) {
+		createTestJob(t, "job-leader", "pelican://origin/a")
+		leader := claimTestEntry(t)
+
+		job := StagingJob{ID: "job-follower", TargetCache: testCache, Priority: PriorityNormal, State: StateQueued, TotalEntries: 1}
+		job.Entries = []StagingJobEntry{{
+			TargetCache: testCache,
+			RequestURL:  "pelican://origin/a",
+			Mode:        "download",
+			Priority:    PriorityNormal,
+			State:       StateQueued,
+		}}
+
+		settled := make(chan []StagingJobEntry, 1)
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&job).Error; err != nil {
+				return err
+			}
+			if err := attachDuplicateEntries(tx, &job); err != nil {
+				return err
+			}
+
+			// The leader finishes while the follower is not committed yet
+			go func() {
+				if err := FinishStagingJobEntry(leader.ID, StateSucceeded, 42, 0, "", ""); err != nil {
+					t.Errorf("FinishStagingJobEntry: %v", err)
+				}
+				followers, err := FinishAttachedEntries(leader.ID, StateSucceeded, 42, 0, "", "")
+				if err != nil {
+					t.Errorf("FinishAttachedEntries: %v", err)
+				}
+				settled <- followers
+			}()
+
+			select {
+			case <-settled:
+				t.Error("leader finished before the attached entry was committed")
+			case <-time.After(200 * time.Millisecond):
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to create the follower job: %v", err)
+		}
+
+		var followers []StagingJobEntry
+		select {
+		case followers = <-settled:
+		case <-time.After(10 * time.Second):
+			t.Fatal("leader did not finish once the follower was committed")
+		}
+		if len(followers) != 1 || followers[0].ID != job.Entries[0].ID {
+			t.Errorf("leader settled %d entries, want the attached entry %d", len(followers), job.Entries[0].ID)
+		}
+		if stored := getTestEntry(t, job.Entries[0].ID); stored.State != StateSucceeded || stored.ObjectSize != 42 {
+			t.Errorf("attached entry is %s with size %d, want the result of its leader", stored.State, stored.ObjectSize)
+		}
+	})
+}
+
+func TestSetStagingJobPriorityOfAttachedEntries(t *testing.T) {
+	forEachDriver(t, func(t *testing.T) {
+		leaderJob := createTestJob(t, "job-leader", "pelican://origin/a")
+		followerJob := createTestJob(t, "job-follower", "pelican://origin/a")
+		leader, follower := leaderJob.Entries[0], followerJob.Entries[0]
+		if follower.AttachedTo == nil || *follower.AttachedTo != leader.ID {
+			t.Fatalf("entry %d is not attached to entry %d", follower.ID, leader.ID)
+		}
+
+		// Promoting the follower's job speeds up its leader
+		if updated, err := SetStagingJobPriority(followerJob.ID, PriorityHigh); err != nil || !updated {
+			t.Fatalf("SetStagingJobPriority = %v, %v", updated, err)
+		}
+		if stored := getTestEntry(t, leader.ID); stored.Priority != PriorityHigh {
+			t.Errorf("leader priority is %s after promoting its follower, want %s", stored.Priority, PriorityHigh)
+		}
+
+		// Demoting the leader's job does not slow down the follower waiting on it
+		if updated, err := SetStagingJobPriority(leaderJob.ID, PriorityBulk); err != nil || !updated {
+			t.Fatalf("SetStagingJobPriority = %v, %v", updated, err)
+		}
+		if stored := getTestEntry(t, leader.ID); stored.Priority != PriorityHigh {
+			t.Errorf("leader priority is %s after demoting its own job, want %s", stored.Priority, PriorityHigh)
+		}
+
+		// Once nothing urgent waits on it, the leader falls back to its own job's priority
+		if updated, err := SetStagingJobPriority(followerJob.ID, PriorityBulk); err != nil || !updated {
+			t.Fatalf("SetStagingJobPriority = %v, %v", updated, err)
+		}
+		if stored := getTestEntry(t, leader.ID); stored.Priority != PriorityBulk {
+			t.Errorf("leader priority is %s after demoting both jobs, want %s", stored.Priority, PriorityBulk)
+		}
+	})
+}
+
+func TestListStagingRecordLites(t *testing.T) {
+	// Timestamps are written with the local offset; one away from UTC shows whether
+	// time bounds are converted before they are compared
+	local := time.Local
+	time.Local = time.FixedZone("UTC-5", -5*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	forEachDriver(t, func(t *testing.T) {
+		base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+		records := []StagingRecord{
+			{PelicanURL: "pelican://origin/dir/a.txt", StagingStorage: "cache-a", ObjectSize: 100},
+			{PelicanURL: "pelican://origin/dir/b.txt", StagingStorage: "cache-a", ObjectSize: 300},
+			{PelicanURL: "pelican://origin/dir/[1].txt", StagingStorage: "cache-a", ObjectSize: 300},
+			{PelicanURL: "pelican://origin/other/c.txt", StagingStorage: "cache-b", ObjectSize: 300},
+			{PelicanURL: "pelican://origin/dir/1.txt", StagingStorage: "cache-b", ObjectSize: 50},
+		}
+		for i := range records {
+			if err := DB.Create(&records[i]).Error; err != nil {
+				t.Fatalf("failed to create record: %v", err)
+			}
+			updatedAt := base.Add(time.Duration(i) * time.Hour)
+			if err := DB.Model(&records[i]).UpdateColumn("updated_at", updatedAt).Error; err != nil {
+				t.Fatalf("failed to set updated_at: %v", err)
+			}
+		}
+
+		// indexes maps the IDs of listed records back to their index in records
+		indexes := func(listed []StagingRecordLite) []int {
+			var result []int
+			for _, record := range listed {
+				for i := range records {
+					if records[i].ID == record.ID {
+						result = append(result, i)
+					}
+				}
+			}
+			return result
+		}
+
+		// paginate lists every page of the filter and returns the records in order
+		paginate := func(filter RecordFilter) []int {
+			var result []int
+			for page := 0; page < len(records); page++ {
+				listed, next, err := ListStagingRecordLites(filter)
+				if err != nil {
+					t.Fatalf("ListStagingRecordLites: %v", err)
+				}
+				result = append(result, indexes(listed)...)
+				if next == "" {
+					return result
+				}
+				filter.Cursor = next
+			}
+			t.Fatalf("paging did not end after %d pages", len(records))
+			return nil
+		}
+
+		pagings := []struct {
+			name   string
+			filter RecordFilter
+			want   []int
+		}{
+			{"by size, ties broken by id", RecordFilter{SortBy: "object_size", Descending: true, Limit: 2}, []int{3, 2, 1, 0, 4}},
+			{"by update time", RecordFilter{SortBy: "updated_at", Limit: 2}, []int{0, 1, 2, 3, 4}},
+			{"by url", RecordFilter{SortBy: "pelican_url", Limit: 3}, []int{4, 2, 0, 1, 3}},
+		}
+		for _, paging := range pagings {
+			if got := paginate(paging.filter); !slices.Equal(got, paging.want) {
+				t.Errorf("paging %s listed records %v, want %v", paging.name, got, paging.want)
+			}
+		}
+
+		filters := []struct {
+			name   string
+			filter RecordFilter
+			want   []int
+		}{
+			{"storage, glob and size", RecordFilter{StagingStorage: "cache-a", URLGlob: "pelican://origin/dir/*", MinSize: ptr(int64(200))}, []int{1, 2}},
+			{"prefix and size range", RecordFilter{URLPrefix: "pelican://origin/dir/", MinSize: ptr(int64(50)), MaxSize: ptr(int64(100))}, []int{0, 4}},
+			{"single character wildcard", RecordFilter{URLGlob: "*/?.txt"}, []int{0, 1, 3, 4}},
+			{"brackets match themselves", RecordFilter{URLGlob: "*/[1].txt"}, []int{2}},
+			{"LIKE wildcards match themselves", RecordFilter{URLGlob: "pelican://origin/dir/_.txt"}, nil},
+			{"time range in other zones", RecordFilter{
+				UpdatedAfter:  ptr(base.Add(2 * time.Hour).UTC()),
+				UpdatedBefore: ptr(base.Add(4 * time.Hour).In(time.FixedZone("UTC+3", 3*60*60))),
+			}, []int{2, 3}},
+			{"job and storage", RecordFilter{JobID: "job-unknown", StagingStorage: "cache-a"}, nil},
+		}
+		for _, filter := range filters {
+			listed, next, err := ListStagingRecordLites(filter.filter)
+			if err != nil {
+				t.Errorf("filter %s: %v", filter.name, err)
+				continue
+			}
+			if got := indexes(listed); !slices.Equal(got, filter.want) || next != "" {
+				t.Errorf("filter %s listed records %v with next cursor %q, want %v on a single page", filter.name, got, next, filter.want)
+			}
+		}
+
+		// A cursor carries its sort and cannot be reused with another one
+		_, next, err := ListStagingRecordLites(RecordFilter{SortBy: "object_size", Limit: 1})
+		if err != nil || next == "" {
+			t.Fatalf("ListStagingRecordLites = %q, %v, want a next cursor", next, err)
+		}
+		if _, _, err := ListStagingRecordLites(RecordFilter{SortBy: "updated_at", Limit: 1, Cursor: next}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("ListStagingRecordLites with a cursor of another sort = %v, want ErrInvalidCursor", err)
+		}
+		if _, _, err := ListStagingRecordLites(RecordFilter{Cursor: "not a cursor"}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("ListStagingRecordLites with a malformed cursor = %v, want ErrInvalidCursor", err)
+		}
+	})
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
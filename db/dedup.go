@@ -0,0 +1,198 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Entries staging the same object to the same cache, with the same mode and parameters,
+// are deduplicated: a queued entry whose object is already queued or running elsewhere is
+// attached to that entry, its leader, instead of being claimed by a worker. Once the
+// leader finishes, its result is copied to every attached entry. If the leader is
+// cancelled, the oldest attached entry takes over and the others are attached to it.
+
+// attachDuplicateEntries attaches the queued entries of a freshly created job to older
+// in-flight entries staging the same object the same way, including earlier entries of the
+// same job. Entries keeping a local copy always stage on their own.
+//
+// The leader row stays locked until the transaction commits, so that the leader cannot
+// finish, and share its result, before the attached entry becomes visible. SQLite takes
+// the database write lock for the whole transaction instead. A leader that finished while
+// its row was awaited is skipped, and the entry stages on its own.
+func attachDuplicateEntries(tx *gorm.DB, job *StagingJob) error {
+	for i := range job.Entries {
+		entry := &job.Entries[i]
+		if entry.State != StateQueued || entry.KeepLocal {
+			continue
+		}
+
+		var leader StagingJobEntry
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("request_url = ? AND target_cache = ? AND mode = ? AND parameters = ? AND state IN ? AND attached_to IS NULL AND id < ?",
+				entry.RequestURL, entry.TargetCache, entry.Mode, entry.Parameters, []string{StateQueued, StateRunning}, entry.ID).
+			Order("id").
+			Limit(1).
+			Find(&leader)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		if err := tx.Model(entry).Update("attached_to", leader.ID).Error; err != nil {
+			return err
+		}
+		entry.AttachedTo = &leader.ID
+
+		// The leader is staged no later than the most urgent entry waiting on it
+		if priorityRank(entry.Priority) > priorityRank(leader.Priority) {
+			if err := tx.Model(&leader).Update("priority", entry.Priority).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// promoteAttachedEntry makes the oldest entry still waiting on the leader a leader of its
+// own and attaches the remaining ones to it. It returns the new leader, if any.
+func promoteAttachedEntry(tx *gorm.DB, leaderID uint) (*StagingJobEntry, error) {
+	var followers []StagingJobEntry
+	err := tx.Where("attached_to = ? AND state = ?", leaderID, StateQueued).
+		Order("id").
+		Find(&followers).Error
+	if err != nil || len(followers) == 0 {
+		return nil, err
+	}
+
+	promoted := followers[0]
+	if err := tx.Model(&promoted).Update("attached_to", nil).Error; err != nil {
+		return nil, err
+	}
+	promoted.AttachedTo = nil
+
+	err = tx.Model(&StagingJobEntry{}).
+		Where("attached_to = ? AND state = ?", leaderID, StateQueued).
+		Update("attached_to", promoted.ID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if err := refreshLeaderPriorities(tx, []uint{promoted.ID}); err != nil {
+		return nil, err
+	}
+	if err := tx.First(&promoted, promoted.ID).Error; err != nil {
+		return nil, err
+	}
+
+	return &promoted, nil
+}
+
+// refreshLeaderPriorities sets the priority of each queued leader to the most urgent of
+// its job's priority and the priorities of the entries waiting on it, so that the leader
+// is staged no later than any of them and no earlier than all of them call for.
+func refreshLeaderPriorities(tx *gorm.DB, leaderIDs []uint) error {
+	if len(leaderIDs) == 0 {
+		return nil
+	}
+
+	var leaders []StagingJobEntry
+	if err := tx.Where("id IN ? AND state = ?", leaderIDs, StateQueued).Find(&leaders).Error; err != nil {
+		return err
+	}
+
+	for _, leader := range leaders {
+		var priorities []string
+		err := tx.Model(&StagingJob{}).Where("id = ?", leader.JobID).Pluck("priority", &priorities).Error
+		if err != nil {
+			return err
+		}
+		var followerPriorities []string
+		err = tx.Model(&StagingJobEntry{}).
+			Where("attached_to = ? AND state = ?", leader.ID, StateQueued).
+			Pluck("priority", &followerPriorities).Error
+		if err != nil {
+			return err
+		}
+
+		effective := ""
+		for _, priority := range append(priorities, followerPriorities...) {
+			if priorityRank(priority) > priorityRank(effective) {
+				effective = priority
+			}
+		}
+		if effective == "" || effective == leader.Priority {
+			continue
+		}
+		if err := tx.Model(&leader).Update("priority", effective).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PromoteAttachedEntry hands the entries attached to a cancelled leader over to the oldest
+// of them, which is returned so that it can be scheduled, or nil if none was waiting.
+func PromoteAttachedEntry(leaderID uint) (*StagingJobEntry, error) {
+	var promoted *StagingJobEntry
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		promoted, err = promoteAttachedEntry(tx, leaderID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to promote an entry attached to entry %d: %v", leaderID, err)
+	}
+	return promoted, nil
+}
+
+// FinishAttachedEntries copies the result of a finished leader to the entries waiting on
+// it and returns those entries.
+func FinishAttachedEntries(leaderID uint, state string, objectSize int64, exitCode int, errorCode, message string) ([]StagingJobEntry, error) {
+	var followers []StagingJobEntry
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("attached_to = ? AND state = ?", leaderID, StateQueued).
+			Order("id").
+			Find(&followers).Error
+		if err != nil || len(followers) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(followers))
+		for i, follower := range followers {
+			ids[i] = follower.ID
+		}
+
+		return tx.Model(&StagingJobEntry{}).
+			Where("id IN ?", ids).
+			Updates(map[string]interface{}{
+				"state":             state,
+				"object_size":       objectSize,
+				"pelican_exit_code": exitCode,
+				"error_code":        errorCode,
+				"message":           message,
+				"finished_at":       time.Now(),
+			}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to finish entries attached to entry %d: %v", leaderID, err)
+	}
+	return followers, nil
+}
+
+// GetFinishedLeaders returns the finished entries that still have entries waiting on them,
+// which happens when the daemon stopped before their result was shared.
+func GetFinishedLeaders() ([]StagingJobEntry, error) {
+	var leaders []StagingJobEntry
+	err := DB.Where("state NOT IN ? AND id IN (?)", []string{StateQueued, StateRunning},
+		DB.Model(&StagingJobEntry{}).Select("attached_to").Where("attached_to IS NOT NULL AND state = ?", StateQueued)).
+		Find(&leaders).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list finished entries with attached entries: %v", err)
+	}
+	return leaders, nil
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// HistoryFilter narrows down history queries; zero fields do not filter
+type HistoryFilter struct {
+	JobID       string
+	EntryID     uint
+	RequestURL  string
+	TargetCache string
+	State       string
+	ErrorCode   string
+	RequestedBy string
+	Priority    string
+	Since       *time.Time // Created at or after
+	Until       *time.Time // Created before
+	Limit       int
+	Offset      int
+}
+
+// apply adds the conditions shared by job and attempt queries
+func (f HistoryFilter) apply(query *gorm.DB) *gorm.DB {
+	if f.JobID != "" {
+		query = query.Where("job_id = ?", f.JobID)
+	}
+	if f.TargetCache != "" {
+		query = query.Where("target_cache = ?", f.TargetCache)
+	}
+	if f.State != "" {
+		query = query.Where("state = ?", f.State)
+	}
+	if f.Since != nil {
+		query = query.Where("created_at >= ?", storedTime(*f.Since))
+	}
+	if f.Until != nil {
+		query = query.Where("created_at < ?", storedTime(*f.Until))
+	}
+	return query
+}
+
+// ListStagingJobs returns the jobs matching the filter, newest first and without their
+// entries, together with the number of matching jobs.
+func ListStagingJobs(filter HistoryFilter) ([]StagingJob, int64, error) {
+	query := DB.Model(&StagingJob{})
+	if filter.JobID != "" {
+		query = query.Where("id = ?", filter.JobID)
+		filter.JobID = ""
+	}
+	if filter.RequestedBy != "" {
+		query = query.Where("requested_by = ?", filter.RequestedBy)
+	}
+	if filter.Priority != "" {
+		query = query.Where("priority = ?", filter.Priority)
+	}
+	if filter.RequestURL != "" {
+		query = query.Where("id IN (?)", DB.Model(&StagingJobEntry{}).Select("job_id").Where("request_url = ?", filter.RequestURL))
+	}
+	query = filter.apply(query)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count staging jobs: %v", err)
+	}
+
+	var jobs []StagingJob
+	err := query.Order("created_at DESC").Order("id").
+		Limit(filter.Limit).Offset(filter.Offset).
+		Find(&jobs).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list staging jobs: %v", err)
+	}
+	return jobs, total, nil
+}
+
+// ListStagingAttempts returns the attempts matching the filter, newest first, together
+// with the number of matching attempts.
+func ListStagingAttempts(filter HistoryFilter) ([]StagingAttempt, int64, error) {
+	query := DB.Model(&StagingAttempt{})
+	if filter.EntryID != 0 {
+		query = query.Where("entry_id = ?", filter.EntryID)
+	}
+	if filter.RequestURL != "" {
+		query = query.Where("request_url = ?", filter.RequestURL)
+	}
+	if filter.ErrorCode != "" {
+		query = query.Where("error_code = ?", filter.ErrorCode)
+	}
+	query = filter.apply(query)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count staging attempts: %v", err)
+	}
+
+	var attempts []StagingAttempt
+	err := query.Order("id DESC").
+		Limit(filter.Limit).Offset(filter.Offset).
+		Find(&attempts).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list staging attempts: %v", err)
+	}
+	return attempts, total, nil
+}
@@ -0,0 +1,419 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// States shared by staging jobs and their entries
+const (
+	StateQueued    = "queued"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+	StateCancelled = "cancelled"
+
+	// StateAlreadyStaged marks entries skipped because a fresh staging record already exists
+	StateAlreadyStaged = "already_staged"
+)
+
+// Priority classes of staging jobs, from most to least urgent
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityBulk   = "bulk"
+)
+
+// Priorities lists the priority classes from most to least urgent
+var Priorities = []string{PriorityHigh, PriorityNormal, PriorityBulk}
+
+// ValidPriority reports whether priority names a priority class
+func ValidPriority(priority string) bool {
+	return priorityRank(priority) >= 0
+}
+
+// priorityRank orders priority classes, higher being more urgent; it is -1 for unknown ones
+func priorityRank(priority string) int {
+	for i, p := range Priorities {
+		if p == priority {
+			return len(Priorities) - 1 - i
+		}
+	}
+	return -1
+}
+
+type StagingJob struct {
+	ID                string            `gorm:"primaryKey;type:varchar(255)" json:"job_id"` // Job ID generated by the request middleware
+	CreatedAt         time.Time         `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt         time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
+	TargetCache       string            `gorm:"type:varchar(255)" json:"target_cache"`
+	Mode              string            `gorm:"type:varchar(32)" json:"mode"`
+	Priority          string            `gorm:"type:varchar(16);default:normal" json:"priority"`
+	State             string            `gorm:"type:varchar(32);index" json:"state"` // Aggregate state of all entries
+	TotalEntries      int               `gorm:"type:int" json:"total_entries"`
+	CallbackURL       string            `gorm:"type:text" json:"callback_url,omitempty"`     // Notified when the job finishes
+	RequestedBy       string            `gorm:"type:varchar(255);index" json:"requested_by"` // Subject of the requesting identity
+	AuthMethod        string            `gorm:"type:varchar(32)" json:"auth_method,omitempty"`
+	StartedAt         *time.Time        `json:"started_at,omitempty"` // When the first entry started staging
+	FinishedAt        *time.Time        `json:"finished_at,omitempty"`
+	CancelRequestedAt *time.Time        `json:"cancel_requested_at,omitempty"` // Running entries are killed by whichever instance runs them
+	Entries           []StagingJobEntry `gorm:"foreignKey:JobID" json:"entries,omitempty"`
+}
+
+type StagingJobEntry struct {
+	ID              uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	JobID           string     `gorm:"type:varchar(255);index" json:"job_id"`
+	TargetCache     string     `gorm:"type:varchar(255)" json:"target_cache"`
+	RequestURL      string     `gorm:"type:varchar(255)" json:"request_url"`
+	Parameters      string     `gorm:"type:text" json:"parameters,omitempty"`
+	Mode            string     `gorm:"type:varchar(32)" json:"mode"`
+	Priority        string     `gorm:"type:varchar(16);default:normal;index" json:"priority"` // Copied from the job
+	KeepLocal       bool       `json:"keep_local,omitempty"`                                  // Keep the downloaded copy after staging
+	LocalPath       string     `gorm:"type:text" json:"local_path,omitempty"`                 // Temporary copy while running, or the kept copy
+	State           string     `gorm:"type:varchar(32);index" json:"state"`
+	ObjectSize      int64      `gorm:"type:bigint" json:"object_size"`
+	PelicanExitCode int        `gorm:"type:int" json:"pelican_client_exit_code"`
+	ErrorCode       string     `gorm:"type:varchar(32)" json:"error_code,omitempty"`  // Category of the last failure
+	Message         string     `gorm:"type:text" json:"message,omitempty"`            // Error message when the entry failed
+	ClaimedBy       string     `gorm:"type:varchar(255)" json:"claimed_by,omitempty"` // Instance that ran the latest attempt
+	LeaseExpiresAt  *time.Time `json:"lease_expires_at,omitempty"`                    // Renewed by ClaimedBy while the entry is running
+	AttachedTo      *uint      `gorm:"index" json:"attached_to,omitempty"`            // Entry staging the same object, whose result this entry shares
+	Attempts        int        `gorm:"type:int;default:0" json:"attempts"`            // Number of attempts started so far
+	NextAttemptAt   *time.Time `json:"next_attempt_at,omitempty"`                     // Set while waiting for a retry
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+
+	AttemptHistory []StagingAttempt `gorm:"foreignKey:EntryID" json:"attempt_history,omitempty"`
+}
+
+// AttemptInterrupted is the state of an attempt cut short by a shutdown or by the loss of
+// its entry's lease. Such attempts do not count, so the next one reuses their number.
+const AttemptInterrupted = "interrupted"
+
+// StagingAttempt records the outcome of a single pelican attempt for an entry
+type StagingAttempt struct {
+	ID              uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	EntryID         uint       `gorm:"index" json:"entry_id"`
+	JobID           string     `gorm:"type:varchar(255);index" json:"job_id"`
+	RequestURL      string     `gorm:"type:varchar(255);index" json:"request_url"`
+	TargetCache     string     `gorm:"type:varchar(255)" json:"target_cache"`
+	Attempt         int        `gorm:"type:int" json:"attempt"`
+	State           string     `gorm:"type:varchar(32)" json:"state"`
+	Retried         bool       `json:"retried"` // Whether the failure was classified as transient and retried
+	PelicanExitCode int        `gorm:"type:int" json:"pelican_client_exit_code"`
+	ErrorCode       string     `gorm:"type:varchar(32)" json:"error_code,omitempty"`
+	PelicanStderr   string     `gorm:"type:text" json:"stderr,omitempty"`
+	Message         string     `gorm:"type:text" json:"message,omitempty"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      time.Time  `json:"finished_at"`
+}
+
+// CreateStagingJob persists a job together with its entries, attaching queued entries to
+// in-flight entries staging the same object.
+func CreateStagingJob(job *StagingJob) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(job).Error; err != nil {
+			return err
+		}
+		return attachDuplicateEntries(tx, job)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create staging job %s: %v", job.ID, err)
+	}
+	return nil
+}
+
+// MarkStagingJobRunning moves a queued job into the running state.
+func MarkStagingJobRunning(jobID string) error {
+	err := DB.Model(&StagingJob{}).
+		Where("id = ? AND state = ?", jobID, StateQueued).
+		Updates(map[string]interface{}{
+			"state":      StateRunning,
+			"started_at": time.Now(),
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to mark staging job %s as running: %v", jobID, err)
+	}
+	return nil
+}
+
+// SetStagingJobEntryLocalPath records where the entry's temporary copy lives; an empty
+// path means there is no local copy.
+func SetStagingJobEntryLocalPath(entryID uint, localPath string) error {
+	err := DB.Model(&StagingJobEntry{}).
+		Where("id = ?", entryID).
+		Update("local_path", localPath).Error
+	if err != nil {
+		return fmt.Errorf("failed to set local path of entry %d: %v", entryID, err)
+	}
+	return nil
+}
+
+// GetProtectedLocalPaths returns the local copies that must survive temp cleanup:
+// those of running entries and those kept on request.
+func GetProtectedLocalPaths() ([]string, error) {
+	var paths []string
+	err := DB.Model(&StagingJobEntry{}).
+		Where("local_path <> '' AND (state = ? OR keep_local = ?)", StateRunning, true).
+		Pluck("local_path", &paths).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list protected local paths: %v", err)
+	}
+	return paths, nil
+}
+
+// finishedEntryFields are the columns set when an entry reaches a final state
+func finishedEntryFields(state string, objectSize int64, exitCode int, errorCode, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"state":             state,
+		"object_size":       objectSize,
+		"pelican_exit_code": exitCode,
+		"error_code":        errorCode,
+		"message":           message,
+		"lease_expires_at":  nil,
+		"finished_at":       time.Now(),
+	}
+}
+
+// FinishStagingJobEntry stores the outcome of an entry running under this instance. It
+// returns ErrEntryNotClaimed if the entry was requeued after its lease expired.
+func FinishStagingJobEntry(entryID uint, state string, objectSize int64, exitCode int, errorCode, message string) error {
+	result := claimedEntry(DB, entryID).Updates(finishedEntryFields(state, objectSize, exitCode, errorCode, message))
+	if result.Error != nil {
+		return fmt.Errorf("failed to finish entry %d: %v", entryID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: entry %d", ErrEntryNotClaimed, entryID)
+	}
+	return nil
+}
+
+// FinishStagedEntry marks an entry running under this instance as succeeded and stores the
+// staging record of its object in one transaction, so that an instance which lost the
+// claim writes neither. It returns ErrEntryNotClaimed in that case.
+func FinishStagedEntry(entry StagingJobEntry, objectSize int64, exitCode int, stdout, stderr string) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := claimedEntry(tx, entry.ID).Updates(finishedEntryFields(StateSucceeded, objectSize, exitCode, "", ""))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrEntryNotClaimed
+		}
+		return insertOrUpdateStagingRecord(tx, entry.RequestURL, entry.TargetCache, entry.JobID, objectSize, exitCode, stdout, stderr)
+	})
+	if errors.Is(err, ErrEntryNotClaimed) {
+		return fmt.Errorf("%w: entry %d", ErrEntryNotClaimed, entry.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record staged entry %d: %v", entry.ID, err)
+	}
+	return nil
+}
+
+// FinishStagingJobIfDone derives the aggregate state of a job from its entries and stores
+// it once no entry is left queued or running. It reports the final state to the one caller
+// that finished the job, and an empty string to every other caller.
+func FinishStagingJobIfDone(jobID string) (string, error) {
+	var pending int64
+	err := DB.Model(&StagingJobEntry{}).
+		Where("job_id = ? AND state IN ?", jobID, []string{StateQueued, StateRunning}).
+		Count(&pending).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to count pending entries of job %s: %v", jobID, err)
+	}
+	if pending > 0 {
+		return "", nil
+	}
+
+	var states []string
+	err = DB.Model(&StagingJobEntry{}).
+		Where("job_id = ?", jobID).
+		Distinct().
+		Pluck("state", &states).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to collect entry states of job %s: %v", jobID, err)
+	}
+
+	// A cancelled job stays cancelled even if some entries failed before the cancellation
+	state := StateSucceeded
+	for _, entryState := range states {
+		if entryState == StateCancelled {
+			state = StateCancelled
+			break
+		}
+		if entryState == StateFailed {
+			state = StateFailed
+		}
+	}
+
+	result := DB.Model(&StagingJob{}).
+		Where("id = ? AND state IN ?", jobID, []string{StateQueued, StateRunning}).
+		Updates(map[string]interface{}{
+			"state":       state,
+			"finished_at": time.Now(),
+		})
+	if result.Error != nil {
+		return "", fmt.Errorf("failed to finish staging job %s: %v", jobID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		// Another caller finished the job first and reports it
+		return "", nil
+	}
+
+	return state, nil
+}
+
+// CancelQueuedEntries marks every queued entry of the job as cancelled so that
+// no worker picks them up, and records the cancellation on the job so that every instance
+// kills the entries it runs. Entries of other jobs attached to a cancelled entry are
+// handed over to one of them.
+func CancelQueuedEntries(jobID string) (int64, error) {
+	var cancelled int64
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&StagingJob{}).
+			Where("id = ? AND cancel_requested_at IS NULL", jobID).
+			Update("cancel_requested_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+
+		var leaderIDs []uint
+		err = tx.Model(&StagingJobEntry{}).
+			Where("job_id = ? AND state = ? AND attached_to IS NULL", jobID, StateQueued).
+			Pluck("id", &leaderIDs).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&StagingJobEntry{}).
+			Where("job_id = ? AND state = ?", jobID, StateQueued).
+			Updates(map[string]interface{}{
+				"state":       StateCancelled,
+				"message":     "Cancelled before staging started",
+				"finished_at": time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		cancelled = result.RowsAffected
+
+		for _, leaderID := range leaderIDs {
+			if _, err := promoteAttachedEntry(tx, leaderID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to cancel queued entries of job %s: %v", jobID, err)
+	}
+	return cancelled, nil
+}
+
+// CountRunningEntries returns the number of entries of the job running on any instance.
+func CountRunningEntries(jobID string) (int64, error) {
+	var running int64
+	err := DB.Model(&StagingJobEntry{}).
+		Where("job_id = ? AND state = ?", jobID, StateRunning).
+		Count(&running).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count running entries of job %s: %v", jobID, err)
+	}
+	return running, nil
+}
+
+// GetCancelRequestedJobIDs returns which of the given jobs have been cancelled.
+func GetCancelRequestedJobIDs(jobIDs []string) ([]string, error) {
+	if len(jobIDs) == 0 {
+		return nil, nil
+	}
+
+	var cancelled []string
+	err := DB.Model(&StagingJob{}).
+		Where("id IN ? AND cancel_requested_at IS NOT NULL", jobIDs).
+		Pluck("id", &cancelled).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cancelled staging jobs: %v", err)
+	}
+	return cancelled, nil
+}
+
+// SetStagingJobPriority changes the priority of a job and of its entries still waiting in
+// the queue. Queued leaders the job's entries wait on, or that are entries of the job, get
+// the priority of their most urgent waiting entry. It reports false if the job has already
+// finished.
+func SetStagingJobPriority(jobID, priority string) (bool, error) {
+	updated := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&StagingJob{}).
+			Where("id = ? AND state IN ?", jobID, []string{StateQueued, StateRunning}).
+			Update("priority", priority)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		updated = true
+
+		err := tx.Model(&StagingJobEntry{}).
+			Where("job_id = ? AND state = ?", jobID, StateQueued).
+			Update("priority", priority).Error
+		if err != nil {
+			return err
+		}
+
+		var leaderIDs []uint
+		err = tx.Model(&StagingJobEntry{}).
+			Where("job_id = ? AND state = ? AND attached_to IS NOT NULL", jobID, StateQueued).
+			Distinct().
+			Pluck("attached_to", &leaderIDs).Error
+		if err != nil {
+			return err
+		}
+		var ownLeaderIDs []uint
+		err = tx.Model(&StagingJobEntry{}).
+			Where("job_id = ? AND state = ? AND attached_to IS NULL", jobID, StateQueued).
+			Pluck("id", &ownLeaderIDs).Error
+		if err != nil {
+			return err
+		}
+
+		return refreshLeaderPriorities(tx, append(leaderIDs, ownLeaderIDs...))
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to set priority of staging job %s: %v", jobID, err)
+	}
+	return updated, nil
+}
+
+// CreateStagingAttempt records the outcome of an attempt.
+func CreateStagingAttempt(attempt *StagingAttempt) error {
+	if err := DB.Create(attempt).Error; err != nil {
+		return fmt.Errorf("failed to record attempt %d of entry %d: %v", attempt.Attempt, attempt.EntryID, err)
+	}
+	return nil
+}
+
+// GetStagingJobByID returns the job with its entries, or nil if it does not exist.
+func GetStagingJobByID(jobID string) (*StagingJob, error) {
+	var job StagingJob
+
+	err := DB.Preload("Entries", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("id")
+	}).Preload("Entries.AttemptHistory", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("attempt")
+	}).First(&job, "id = ?", jobID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to retrieve staging job %s: %v", jobID, err)
+	}
+
+	return &job, nil
+}
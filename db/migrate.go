@@ -0,0 +1,373 @@
+package db
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// migrationFiles holds one directory of migrations per driver. Each migration is a pair of
+// files named NNNN_name.up.sql and NNNN_name.down.sql.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer release, whose
+// schema this build does not know
+var ErrSchemaTooNew = errors.New("database schema is newer than this build supports")
+
+// Migration is one versioned schema change and the statements that revert it
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaMigration records a migration applied to the database
+type SchemaMigration struct {
+	Version   uint      `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(255)"`
+	AppliedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// MigrationState is a migration together with whether it has been applied. Versions
+// applied by a newer release have no statements and Unknown set.
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+	Unknown   bool
+}
+
+// migrationLockKey identifies the PostgreSQL advisory lock held while migrating
+const migrationLockKey = 0x70656c6963616e // "pelican"
+
+// legacyTables names the table created by each migration that predates versioning;
+// databases set up by AutoMigrate are adopted at the versions whose tables they hold
+var legacyTables = map[uint]string{
+	1: "staging_records",
+	2: "staging_job_entries",
+	3: "webhook_deliveries",
+}
+
+// loadMigrations reads the migrations of the connected driver, ordered by version
+func loadMigrations() ([]Migration, error) {
+	dir := path.Join("migrations", DB.Dialector.Name())
+	files, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver %s: %v", DB.Dialector.Name(), err)
+	}
+
+	byVersion := make(map[uint]*Migration)
+	for _, file := range files {
+		match := migrationFilePattern.FindStringSubmatch(file.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", file.Name())
+		}
+		version, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("invalid version in migration file %s", file.Name())
+		}
+		contents, err := fs.ReadFile(migrationFiles, path.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration file %s: %v", file.Name(), err)
+		}
+
+		migration := byVersion[uint(version)]
+		if migration == nil {
+			migration = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[uint(version)] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, migration := range migrations {
+		if migration.Version != uint(i+1) {
+			return nil, fmt.Errorf("migration versions must be consecutive, found %d after %d", migration.Version, i)
+		}
+	}
+	return migrations, nil
+}
+
+// prepareSchemaMigrations creates the schema_migrations table if needed and adopts a
+// database created before migrations were versioned
+func prepareSchemaMigrations() error {
+	migrator := DB.Migrator()
+	if !migrator.HasTable(&SchemaMigration{}) {
+		if err := migrator.CreateTable(&SchemaMigration{}); err != nil {
+			return fmt.Errorf("failed to create schema_migrations table: %v", err)
+		}
+	}
+
+	var applied int64
+	if err := DB.Model(&SchemaMigration{}).Count(&applied).Error; err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	for _, migration := range migrations {
+		table, ok := legacyTables[migration.Version]
+		if !ok || !migrator.HasTable(table) {
+			break
+		}
+		if err := DB.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name}).Error; err != nil {
+			return fmt.Errorf("failed to record existing schema version %d: %v", migration.Version, err)
+		}
+		log.Info("Adopted existing schema", zap.Uint("version", migration.Version), zap.String("name", migration.Name))
+	}
+	return nil
+}
+
+// appliedMigrations returns the rows of schema_migrations by version
+func appliedMigrations() (map[uint]SchemaMigration, error) {
+	if err := prepareSchemaMigrations(); err != nil {
+		return nil, err
+	}
+
+	var rows []SchemaMigration
+	if err := DB.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+	applied := make(map[uint]SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// MigrationStatus lists the known migrations, followed by any version applied by a newer release
+func MigrationStatus() ([]MigrationState, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, migration := range migrations {
+		state := MigrationState{Migration: migration}
+		if row, ok := applied[migration.Version]; ok {
+			state.AppliedAt = &row.AppliedAt
+			delete(applied, migration.Version)
+		}
+		states = append(states, state)
+	}
+
+	unknown := make([]MigrationState, 0, len(applied))
+	for _, row := range applied {
+		appliedAt := row.AppliedAt
+		unknown = append(unknown, MigrationState{
+			Migration: Migration{Version: row.Version, Name: row.Name},
+			AppliedAt: &appliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(unknown, func(i, j int) bool {
+		return unknown[i].Version < unknown[j].Version
+	})
+	return append(states, unknown...), nil
+}
+
+// SchemaVersion returns the version the database is at and the latest version this build knows
+func SchemaVersion() (current, latest uint, err error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, 0, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for version := range applied {
+		if version > current {
+			current = version
+		}
+	}
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+	return current, latest, nil
+}
+
+// withMigrationLock runs migrate while holding the PostgreSQL advisory lock, so that
+// instances starting together migrate one after the other; the versions applied must be
+// read after the lock is acquired. Only PostgreSQL databases are shared between instances.
+func withMigrationLock(migrate func() error) error {
+	if DB.Dialector.Name() != DriverPostgres {
+		return migrate()
+	}
+
+	// Advisory locks belong to a session, so lock and unlock on the same connection
+	return DB.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+			return fmt.Errorf("failed to acquire the migration lock: %v", err)
+		}
+		defer func() {
+			if err := conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey).Error; err != nil {
+				log.Error("Failed to release the migration lock", zap.Error(err))
+			}
+		}()
+		return migrate()
+	})
+}
+
+// MigrateUp applies the pending migrations up to the target version, or all of them when
+// target is 0. It refuses to touch a database migrated by a newer release.
+func MigrateUp(target uint) ([]Migration, error) {
+	var applied []Migration
+	err := withMigrationLock(func() error {
+		var err error
+		applied, err = migrateUp(target)
+		return err
+	})
+	return applied, err
+}
+
+func migrateUp(target uint) ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	current, latest, err := SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if current > latest {
+		return nil, fmt.Errorf("%w: database is at version %d, latest known is %d", ErrSchemaTooNew, current, latest)
+	}
+	if target == 0 {
+		target = latest
+	}
+	if target > latest {
+		return nil, fmt.Errorf("unknown target version %d, latest known is %d", target, latest)
+	}
+
+	var applied []Migration
+	for _, migration := range migrations {
+		if migration.Version <= current || migration.Version > target {
+			continue
+		}
+		err := runMigration(migration.Up, func(tx *gorm.DB) error {
+			return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name}).Error
+		})
+		if err != nil {
+			return applied, fmt.Errorf("failed to apply migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+		log.Info("Applied migration", zap.Uint("version", migration.Version), zap.String("name", migration.Name))
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+// MigrateDown reverts the given number of most recent migrations
+func MigrateDown(steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := withMigrationLock(func() error {
+		var err error
+		reverted, err = migrateDown(steps)
+		return err
+	})
+	return reverted, err
+}
+
+func migrateDown(steps int) ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	current, latest, err := SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if current > latest {
+		return nil, fmt.Errorf("%w: database is at version %d, latest known is %d", ErrSchemaTooNew, current, latest)
+	}
+
+	var reverted []Migration
+	for i := int(current) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration := migrations[i]
+		err := runMigration(migration.Down, func(tx *gorm.DB) error {
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("failed to revert migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+		log.Info("Reverted migration", zap.Uint("version", migration.Version), zap.String("name", migration.Name))
+		reverted = append(reverted, migration)
+	}
+	return reverted, nil
+}
+
+// runMigration executes the statements of a migration file and updates schema_migrations
+// in one transaction, so that a failing migration leaves the schema untouched
+func runMigration(script string, record func(tx *gorm.DB) error) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range splitStatements(script) {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return record(tx)
+	})
+}
+
+// splitStatements breaks a migration file into statements, since not every driver runs
+// several statements in one call. Statements end with a semicolon at the end of a line.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
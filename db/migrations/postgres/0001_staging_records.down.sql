@@ -0,0 +1 @@
+DROP TABLE "staging_records";
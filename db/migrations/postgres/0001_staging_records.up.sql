@@ -0,0 +1,13 @@
+CREATE TABLE "staging_records" (
+    "id" bigserial PRIMARY KEY,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "pelican_url" varchar(255),
+    "staging_storage" varchar(255),
+    "object_size" bigint,
+    "job_id" varchar(255),
+    "pelican_exit_code" integer,
+    "pelican_stdout" text,
+    "pelican_stderr" text
+);
+CREATE UNIQUE INDEX "idx_pelican_staging" ON "staging_records"("pelican_url", "staging_storage");
@@ -0,0 +1,67 @@
+CREATE TABLE "staging_jobs" (
+    "id" varchar(255) PRIMARY KEY,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "target_cache" varchar(255),
+    "mode" varchar(32),
+    "priority" varchar(16) DEFAULT 'normal',
+    "state" varchar(32),
+    "total_entries" integer,
+    "callback_url" text,
+    "requested_by" varchar(255),
+    "auth_method" varchar(32),
+    "started_at" timestamptz,
+    "finished_at" timestamptz
+);
+CREATE INDEX "idx_staging_jobs_requested_by" ON "staging_jobs"("requested_by");
+CREATE INDEX "idx_staging_jobs_state" ON "staging_jobs"("state");
+
+CREATE TABLE "staging_job_entries" (
+    "id" bigserial PRIMARY KEY,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "job_id" varchar(255) REFERENCES "staging_jobs"("id"),
+    "target_cache" varchar(255),
+    "request_url" varchar(255),
+    "parameters" text,
+    "mode" varchar(32),
+    "priority" varchar(16) DEFAULT 'normal',
+    "keep_local" boolean,
+    "local_path" text,
+    "state" varchar(32),
+    "object_size" bigint,
+    "pelican_exit_code" integer,
+    "error_code" varchar(32),
+    "message" text,
+    "claimed_by" varchar(255),
+    "attached_to" bigint,
+    "attempts" integer DEFAULT 0,
+    "next_attempt_at" timestamptz,
+    "started_at" timestamptz,
+    "finished_at" timestamptz
+);
+CREATE INDEX "idx_staging_job_entries_attached_to" ON "staging_job_entries"("attached_to");
+CREATE INDEX "idx_staging_job_entries_state" ON "staging_job_entries"("state");
+CREATE INDEX "idx_staging_job_entries_priority" ON "staging_job_entries"("priority");
+CREATE INDEX "idx_staging_job_entries_job_id" ON "staging_job_entries"("job_id");
+
+CREATE TABLE "staging_attempts" (
+    "id" bigserial PRIMARY KEY,
+    "created_at" timestamptz,
+    "entry_id" bigint REFERENCES "staging_job_entries"("id"),
+    "job_id" varchar(255),
+    "request_url" varchar(255),
+    "target_cache" varchar(255),
+    "attempt" integer,
+    "state" varchar(32),
+    "retried" boolean,
+    "pelican_exit_code" integer,
+    "error_code" varchar(32),
+    "pelican_stderr" text,
+    "message" text,
+    "started_at" timestamptz,
+    "finished_at" timestamptz
+);
+CREATE INDEX "idx_staging_attempts_request_url" ON "staging_attempts"("request_url");
+CREATE INDEX "idx_staging_attempts_job_id" ON "staging_attempts"("job_id");
+CREATE INDEX "idx_staging_attempts_entry_id" ON "staging_attempts"("entry_id");
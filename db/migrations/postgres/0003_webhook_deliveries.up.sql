@@ -0,0 +1,17 @@
+CREATE TABLE "webhook_deliveries" (
+    "id" bigserial PRIMARY KEY,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "job_id" varchar(255),
+    "url" text,
+    "event" varchar(64),
+    "payload" text,
+    "state" varchar(32),
+    "attempts" integer DEFAULT 0,
+    "last_status_code" integer,
+    "last_error" text,
+    "next_attempt_at" timestamptz,
+    "delivered_at" timestamptz
+);
+CREATE INDEX "idx_webhook_deliveries_state" ON "webhook_deliveries"("state");
+CREATE INDEX "idx_webhook_deliveries_job_id" ON "webhook_deliveries"("job_id");
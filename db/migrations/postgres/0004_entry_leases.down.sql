@@ -0,0 +1 @@
+ALTER TABLE "staging_job_entries" DROP COLUMN "lease_expires_at";
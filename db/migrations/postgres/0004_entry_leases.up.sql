@@ -0,0 +1 @@
+ALTER TABLE "staging_job_entries" ADD COLUMN "lease_expires_at" timestamptz;
@@ -0,0 +1 @@
+ALTER TABLE "staging_jobs" DROP COLUMN "cancel_requested_at";
@@ -0,0 +1,2 @@
+ALTER TABLE "webhook_deliveries" DROP COLUMN "lease_expires_at";
+ALTER TABLE "webhook_deliveries" DROP COLUMN "claimed_by";
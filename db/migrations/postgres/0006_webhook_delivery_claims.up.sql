@@ -0,0 +1,2 @@
+ALTER TABLE "webhook_deliveries" ADD COLUMN "claimed_by" varchar(255);
+ALTER TABLE "webhook_deliveries" ADD COLUMN "lease_expires_at" timestamptz;
@@ -0,0 +1,3 @@
+DROP TABLE `staging_attempts`;
+DROP TABLE `staging_job_entries`;
+DROP TABLE `staging_jobs`;
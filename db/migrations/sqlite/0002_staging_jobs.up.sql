@@ -0,0 +1,70 @@
+CREATE TABLE `staging_jobs` (
+    `id` varchar(255),
+    `created_at` datetime,
+    `updated_at` datetime,
+    `target_cache` varchar(255),
+    `mode` varchar(32),
+    `priority` varchar(16) DEFAULT 'normal',
+    `state` varchar(32),
+    `total_entries` integer,
+    `callback_url` text,
+    `requested_by` varchar(255),
+    `auth_method` varchar(32),
+    `started_at` datetime,
+    `finished_at` datetime,
+    PRIMARY KEY (`id`)
+);
+CREATE INDEX `idx_staging_jobs_requested_by` ON `staging_jobs`(`requested_by`);
+CREATE INDEX `idx_staging_jobs_state` ON `staging_jobs`(`state`);
+
+CREATE TABLE `staging_job_entries` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `job_id` varchar(255),
+    `target_cache` varchar(255),
+    `request_url` varchar(255),
+    `parameters` text,
+    `mode` varchar(32),
+    `priority` varchar(16) DEFAULT 'normal',
+    `keep_local` numeric,
+    `local_path` text,
+    `state` varchar(32),
+    `object_size` bigint,
+    `pelican_exit_code` integer,
+    `error_code` varchar(32),
+    `message` text,
+    `claimed_by` varchar(255),
+    `attached_to` integer,
+    `attempts` integer DEFAULT 0,
+    `next_attempt_at` datetime,
+    `started_at` datetime,
+    `finished_at` datetime,
+    CONSTRAINT `fk_staging_jobs_entries` FOREIGN KEY (`job_id`) REFERENCES `staging_jobs`(`id`)
+);
+CREATE INDEX `idx_staging_job_entries_attached_to` ON `staging_job_entries`(`attached_to`);
+CREATE INDEX `idx_staging_job_entries_state` ON `staging_job_entries`(`state`);
+CREATE INDEX `idx_staging_job_entries_priority` ON `staging_job_entries`(`priority`);
+CREATE INDEX `idx_staging_job_entries_job_id` ON `staging_job_entries`(`job_id`);
+
+CREATE TABLE `staging_attempts` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `entry_id` integer,
+    `job_id` varchar(255),
+    `request_url` varchar(255),
+    `target_cache` varchar(255),
+    `attempt` integer,
+    `state` varchar(32),
+    `retried` numeric,
+    `pelican_exit_code` integer,
+    `error_code` varchar(32),
+    `pelican_stderr` text,
+    `message` text,
+    `started_at` datetime,
+    `finished_at` datetime,
+    CONSTRAINT `fk_staging_job_entries_attempt_history` FOREIGN KEY (`entry_id`) REFERENCES `staging_job_entries`(`id`)
+);
+CREATE INDEX `idx_staging_attempts_request_url` ON `staging_attempts`(`request_url`);
+CREATE INDEX `idx_staging_attempts_job_id` ON `staging_attempts`(`job_id`);
+CREATE INDEX `idx_staging_attempts_entry_id` ON `staging_attempts`(`entry_id`);
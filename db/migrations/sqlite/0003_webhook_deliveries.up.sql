@@ -0,0 +1,17 @@
+CREATE TABLE `webhook_deliveries` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `job_id` varchar(255),
+    `url` text,
+    `event` varchar(64),
+    `payload` text,
+    `state` varchar(32),
+    `attempts` integer DEFAULT 0,
+    `last_status_code` integer,
+    `last_error` text,
+    `next_attempt_at` datetime,
+    `delivered_at` datetime
+);
+CREATE INDEX `idx_webhook_deliveries_state` ON `webhook_deliveries`(`state`);
+CREATE INDEX `idx_webhook_deliveries_job_id` ON `webhook_deliveries`(`job_id`);
@@ -0,0 +1 @@
+ALTER TABLE `staging_jobs` ADD COLUMN `cancel_requested_at` datetime;
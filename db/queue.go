@@ -0,0 +1,297 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+)
+
+// The staging_job_entries table doubles as the persistent staging queue: entries are
+// inserted as queued, claimed by a worker by moving them to running, and finished
+// with a terminal state. Anything still running when the daemon stops is put back
+// in the queue on the next start, or by another daemon sharing the database once the
+// lease of the running entry has expired.
+
+// instanceID identifies the entries claimed by this daemon, so that daemons sharing a
+// database only renew the leases of their own entries
+var instanceID = sync.OnceValue(func() string {
+	if id := config.AppConfig.Staging.InstanceID; id != "" {
+		return id
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Warn("Failed to determine the hostname, set staging.instance_id", zap.Error(err))
+		return "unknown"
+	}
+	return hostname
+})
+
+// ErrEntryNotClaimed is returned when an entry is no longer running under this instance,
+// because its lease expired and it was requeued, possibly for another instance
+var ErrEntryNotClaimed = errors.New("entry is no longer claimed by this instance")
+
+// claimedEntry selects an entry while it is running under this instance
+func claimedEntry(tx *gorm.DB, entryID uint) *gorm.DB {
+	return tx.Model(&StagingJobEntry{}).
+		Where("id = ? AND state = ? AND claimed_by = ?", entryID, StateRunning, instanceID())
+}
+
+// claimableEntries selects the queued entries a worker may pick up now. Attached entries
+// are never claimed; they wait for the entry they are attached to.
+func claimableEntries(tx *gorm.DB) *gorm.DB {
+	return tx.Model(&StagingJobEntry{}).
+		Where("state = ? AND attached_to IS NULL AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", StateQueued, time.Now())
+}
+
+// GetClaimableCaches returns, per priority class, the target caches with entries ready
+// to be claimed.
+func GetClaimableCaches() (map[string][]string, error) {
+	type result struct {
+		Priority    string
+		TargetCache string
+	}
+	var results []result
+
+	err := claimableEntries(DB).
+		Distinct("priority", "target_cache").
+		Order("target_cache").
+		Scan(&results).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list caches with queued entries: %v", err)
+	}
+
+	caches := make(map[string][]string)
+	for _, r := range results {
+		caches[r.Priority] = append(caches[r.Priority], r.TargetCache)
+	}
+	return caches, nil
+}
+
+// CountRunningEntriesByCache returns the number of running entries per target cache.
+func CountRunningEntriesByCache() (map[string]int, error) {
+	type result struct {
+		TargetCache string
+		Running     int
+	}
+	var results []result
+
+	err := DB.Model(&StagingJobEntry{}).
+		Select("target_cache, COUNT(*) AS running").
+		Where("state = ?", StateRunning).
+		Group("target_cache").
+		Scan(&results).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count running entries: %v", err)
+	}
+
+	running := make(map[string]int, len(results))
+	for _, r := range results {
+		running[r.TargetCache] = r.Running
+	}
+	return running, nil
+}
+
+// ClaimNextQueuedEntry atomically moves the oldest claimable entry of the priority class and
+// target cache to running, counting the attempt, and returns it, or nil if nothing is ready.
+func ClaimNextQueuedEntry(priority, targetCache string) (*StagingJobEntry, error) {
+	var claimed *StagingJobEntry
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var entry StagingJobEntry
+		err := claimableEntries(tx).
+			Where("priority = ? AND target_cache = ?", priority, targetCache).
+			Order("id").
+			First(&entry).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		now := time.Now()
+		result := tx.Model(&StagingJobEntry{}).
+			Where("id = ? AND state = ?", entry.ID, StateQueued).
+			Updates(map[string]interface{}{
+				"state":            StateRunning,
+				"claimed_by":       instanceID(),
+				"lease_expires_at": now.Add(config.AppConfig.Staging.LeaseDuration),
+				"started_at":       now,
+				"next_attempt_at":  nil,
+				"attempts":         gorm.Expr("attempts + 1"),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Someone else claimed it first
+			return nil
+		}
+
+		leaseExpiresAt := now.Add(config.AppConfig.Staging.LeaseDuration)
+		entry.State = StateRunning
+		entry.ClaimedBy = instanceID()
+		entry.LeaseExpiresAt = &leaseExpiresAt
+		entry.StartedAt = &now
+		entry.NextAttemptAt = nil
+		entry.Attempts++
+		claimed = &entry
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim queued entry for cache %s: %v", targetCache, err)
+	}
+
+	return claimed, nil
+}
+
+// RequeueEntryForRetry puts a failed entry running under this instance back in the queue,
+// to be picked up no earlier than nextAttemptAt. The failure of the last attempt is kept
+// for status reporting. It returns ErrEntryNotClaimed if the entry was requeued after
+// its lease expired.
+func RequeueEntryForRetry(entryID uint, nextAttemptAt time.Time, errorCode, message string) error {
+	result := claimedEntry(DB, entryID).
+		Updates(map[string]interface{}{
+			"state":            StateQueued,
+			"lease_expires_at": nil,
+			"started_at":       nil,
+			"next_attempt_at":  nextAttemptAt,
+			"error_code":       errorCode,
+			"message":          message,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to requeue entry %d for retry: %v", entryID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: entry %d", ErrEntryNotClaimed, entryID)
+	}
+	return nil
+}
+
+// RequeueInterruptedEntries puts entries left running by a previous process of this instance
+// back in the queue. The interrupted attempt does not count against the retry budget.
+func RequeueInterruptedEntries() (int64, error) {
+	result := DB.Model(&StagingJobEntry{}).
+		Where("state = ? AND (claimed_by = ? OR claimed_by = '' OR claimed_by IS NULL)", StateRunning, instanceID()).
+		Updates(map[string]interface{}{
+			"state":            StateQueued,
+			"lease_expires_at": nil,
+			"started_at":       nil,
+			"attempts":         gorm.Expr("CASE WHEN attempts > 0 THEN attempts - 1 ELSE 0 END"),
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to requeue interrupted entries: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// RequeueInterruptedEntry puts a single entry running under this instance back in the
+// queue, for instance when it was killed by a shutdown. The interrupted attempt does not
+// count either. It returns ErrEntryNotClaimed if the entry was requeued already.
+func RequeueInterruptedEntry(entryID uint) error {
+	result := claimedEntry(DB, entryID).
+		Updates(map[string]interface{}{
+			"state":            StateQueued,
+			"lease_expires_at": nil,
+			"started_at":       nil,
+			"attempts":         gorm.Expr("CASE WHEN attempts > 0 THEN attempts - 1 ELSE 0 END"),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to requeue interrupted entry %d: %v", entryID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: entry %d", ErrEntryNotClaimed, entryID)
+	}
+	return nil
+}
+
+// RenewEntryLeases extends the leases of the given entries still running under this
+// instance and returns the IDs of those it renewed. Entries missing from the result were
+// finished or requeued in the meantime, possibly by another instance after their lease ran out.
+func RenewEntryLeases(entryIDs []uint) ([]uint, error) {
+	if len(entryIDs) == 0 {
+		return nil, nil
+	}
+
+	var renewed []uint
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		held := tx.Model(&StagingJobEntry{}).
+			Where("id IN ? AND state = ? AND claimed_by = ?", entryIDs, StateRunning, instanceID())
+		err := held.Session(&gorm.Session{}).
+			Update("lease_expires_at", time.Now().Add(config.AppConfig.Staging.LeaseDuration)).Error
+		if err != nil {
+			return err
+		}
+		return held.Session(&gorm.Session{}).Pluck("id", &renewed).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to renew entry leases: %v", err)
+	}
+	return renewed, nil
+}
+
+// RequeueExpiredEntries puts running entries whose lease has expired back in the queue,
+// whichever instance claimed them. The interrupted attempt does not count against the
+// retry budget.
+func RequeueExpiredEntries() (int64, error) {
+	result := DB.Model(&StagingJobEntry{}).
+		Where("state = ? AND lease_expires_at < ?", StateRunning, time.Now()).
+		Updates(map[string]interface{}{
+			"state":            StateQueued,
+			"lease_expires_at": nil,
+			"started_at":       nil,
+			"attempts":         gorm.Expr("CASE WHEN attempts > 0 THEN attempts - 1 ELSE 0 END"),
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to requeue entries with an expired lease: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// GetUnfinishedStagingJobIDs returns the IDs of jobs that have not reached a final state.
+func GetUnfinishedStagingJobIDs() ([]string, error) {
+	var jobIDs []string
+	err := DB.Model(&StagingJob{}).
+		Where("state IN ?", []string{StateQueued, StateRunning}).
+		Pluck("id", &jobIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unfinished staging jobs: %v", err)
+	}
+	return jobIDs, nil
+}
+
+// CacheQueueDepth counts the unfinished entries of a target cache by what they wait for.
+type CacheQueueDepth struct {
+	TargetCache  string `json:"target_cache"`
+	Queued       int    `json:"queued"`        // Ready to be claimed
+	WaitingRetry int    `json:"waiting_retry"` // Requeued, waiting for their next attempt
+	Attached     int    `json:"attached"`      // Waiting on an entry staging the same object
+	Running      int    `json:"running"`
+}
+
+// GetQueueDepthByCache returns the queue depth of every target cache with unfinished entries.
+func GetQueueDepthByCache() ([]CacheQueueDepth, error) {
+	var depths []CacheQueueDepth
+	err := DB.Model(&StagingJobEntry{}).
+		Select(`target_cache,
+			SUM(CASE WHEN state = ? AND attached_to IS NULL AND (next_attempt_at IS NULL OR next_attempt_at <= ?) THEN 1 ELSE 0 END) AS queued,
+			SUM(CASE WHEN state = ? AND attached_to IS NULL AND next_attempt_at > ? THEN 1 ELSE 0 END) AS waiting_retry,
+			SUM(CASE WHEN state = ? AND attached_to IS NOT NULL THEN 1 ELSE 0 END) AS attached,
+			SUM(CASE WHEN state = ? THEN 1 ELSE 0 END) AS running`,
+			StateQueued, time.Now(), StateQueued, time.Now(), StateQueued, StateRunning).
+		Where("state IN ?", []string{StateQueued, StateRunning}).
+		Group("target_cache").
+		Order("target_cache").
+		Scan(&depths).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute queue depth: %v", err)
+	}
+	return depths, nil
+}
@@ -0,0 +1,277 @@
+package db
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// Columns records can be sorted by
+var RecordSortColumns = []string{"id", "pelican_url", "staging_storage", "object_size", "updated_at"}
+
+// ErrInvalidCursor is returned for a cursor that was not issued for the requested listing
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// RecordFilter narrows down record listings; zero fields do not filter
+type RecordFilter struct {
+	StagingStorage string
+	URLPrefix      string
+	URLGlob        string // * matches any run of characters, ? a single one, anything else itself
+	JobID          string
+	MinSize        *int64
+	MaxSize        *int64
+	UpdatedAfter   *time.Time
+	UpdatedBefore  *time.Time
+	SortBy         string // One of RecordSortColumns, defaults to id
+	Descending     bool
+	Limit          int    // 0 returns every matching record
+	Cursor         string // next_cursor of the previous page
+}
+
+// recordCursor is the position after the last record of a page. It carries the sort so
+// that a cursor is not reused with a different one.
+type recordCursor struct {
+	SortBy     string      `json:"s"`
+	Descending bool        `json:"d,omitempty"`
+	Value      interface{} `json:"v"`
+	ID         uint        `json:"id"`
+}
+
+// ValidRecordSort reports whether records can be sorted by the column
+func ValidRecordSort(column string) bool {
+	for _, valid := range RecordSortColumns {
+		if column == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// ListStagingRecordLites returns a page of the records matching the filter, and the cursor
+// of the next page, which is empty on the last one. Pages are keyed on the sort column and
+// the ID, so records added or removed meanwhile do not shift them.
+func ListStagingRecordLites(filter RecordFilter) ([]StagingRecordLite, string, error) {
+	if filter.SortBy == "" {
+		filter.SortBy = "id"
+	}
+	if !ValidRecordSort(filter.SortBy) {
+		return nil, "", fmt.Errorf("unsupported sort column %q", filter.SortBy)
+	}
+
+	query := filter.apply(DB.Model(&StagingRecord{}))
+
+	if filter.Cursor != "" {
+		cursor, err := decodeRecordCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if cursor.SortBy != filter.SortBy || cursor.Descending != filter.Descending {
+			return nil, "", fmt.Errorf("%w: issued for a different sort order", ErrInvalidCursor)
+		}
+		query = cursor.apply(query)
+	}
+
+	direction := "ASC"
+	if filter.Descending {
+		direction = "DESC"
+	}
+	if filter.SortBy != "id" {
+		query = query.Order(filter.SortBy + " " + direction)
+	}
+	query = query.Order("id " + direction)
+
+	if filter.Limit > 0 {
+		// One extra record tells whether there is a next page
+		query = query.Limit(filter.Limit + 1)
+	}
+
+	var records []StagingRecordLite
+	if err := query.Find(&records).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to list staging records: %v", err)
+	}
+
+	if filter.Limit == 0 || len(records) <= filter.Limit {
+		return records, "", nil
+	}
+	records = records[:filter.Limit]
+	next, err := encodeRecordCursor(filter, records[len(records)-1])
+	if err != nil {
+		return nil, "", err
+	}
+	return records, next, nil
+}
+
+// apply adds the filter conditions to a record query
+func (f RecordFilter) apply(query *gorm.DB) *gorm.DB {
+	if f.StagingStorage != "" {
+		query = query.Where("staging_storage = ?", f.StagingStorage)
+	}
+	if f.URLPrefix != "" {
+		query = query.Where("substr(pelican_url, 1, ?) = ?", utf8.RuneCountInString(f.URLPrefix), f.URLPrefix)
+	}
+	if f.URLGlob != "" {
+		if DB.Dialector.Name() == DriverPostgres {
+			query = query.Where(`pelican_url LIKE ? ESCAPE '\'`, globToLike(f.URLGlob))
+		} else {
+			query = query.Where("pelican_url GLOB ?", globToSQLiteGlob(f.URLGlob))
+		}
+	}
+	if f.JobID != "" {
+		query = query.Where("job_id = ?", f.JobID)
+	}
+	if f.MinSize != nil {
+		query = query.Where("object_size >= ?", *f.MinSize)
+	}
+	if f.MaxSize != nil {
+		query = query.Where("object_size <= ?", *f.MaxSize)
+	}
+	if f.UpdatedAfter != nil {
+		query = query.Where("updated_at >= ?", storedTime(*f.UpdatedAfter))
+	}
+	if f.UpdatedBefore != nil {
+		query = query.Where("updated_at < ?", storedTime(*f.UpdatedBefore))
+	}
+	return query
+}
+
+// apply restricts a record query to the records after the cursor
+func (c recordCursor) apply(query *gorm.DB) *gorm.DB {
+	comparison := ">"
+	if c.Descending {
+		comparison = "<"
+	}
+	if c.SortBy == "id" {
+		return query.Where("id "+comparison+" ?", c.ID)
+	}
+	return query.Where(
+		fmt.Sprintf("(%[1]s %[2]s ?) OR (%[1]s = ? AND id %[2]s ?)", c.SortBy, comparison),
+		c.Value, c.Value, c.ID,
+	)
+}
+
+// encodeRecordCursor builds the cursor pointing after the record
+func encodeRecordCursor(filter RecordFilter, last StagingRecordLite) (string, error) {
+	cursor := recordCursor{SortBy: filter.SortBy, Descending: filter.Descending, ID: last.ID}
+	switch filter.SortBy {
+	case "pelican_url":
+		cursor.Value = last.PelicanURL
+	case "staging_storage":
+		cursor.Value = last.StagingStorage
+	case "object_size":
+		cursor.Value = last.ObjectSize
+	case "updated_at":
+		cursor.Value = last.UpdatedAt.Format(time.RFC3339Nano)
+	}
+
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeRecordCursor parses a cursor and restores the type of its sort value
+func decodeRecordCursor(encoded string) (recordCursor, error) {
+	var cursor recordCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&cursor); err != nil || !ValidRecordSort(cursor.SortBy) {
+		return cursor, ErrInvalidCursor
+	}
+
+	switch cursor.SortBy {
+	case "pelican_url", "staging_storage":
+		value, ok := cursor.Value.(string)
+		if !ok {
+			return cursor, ErrInvalidCursor
+		}
+		cursor.Value = value
+	case "object_size":
+		number, ok := cursor.Value.(json.Number)
+		if !ok {
+			return cursor, ErrInvalidCursor
+		}
+		value, err := number.Int64()
+		if err != nil {
+			return cursor, ErrInvalidCursor
+		}
+		cursor.Value = value
+	case "updated_at":
+		text, ok := cursor.Value.(string)
+		if !ok {
+			return cursor, ErrInvalidCursor
+		}
+		value, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return cursor, ErrInvalidCursor
+		}
+		cursor.Value = storedTime(value)
+	}
+	return cursor, nil
+}
+
+// storedTime converts a time to the zone timestamps are written in. SQLite keeps them as
+// text with the writer's UTC offset and compares them as text, so a bound time in another
+// offset, typically UTC from a query string, would select the wrong rows.
+func storedTime(t time.Time) time.Time {
+	return t.In(time.Local)
+}
+
+// Record URL globs support the same subset on every driver: * and ? are the only wildcards,
+// so the character classes of SQLite's GLOB are matched literally.
+
+// globToSQLiteGlob escapes the brackets of a glob, which GLOB reads as character classes
+func globToSQLiteGlob(glob string) string {
+	return strings.ReplaceAll(glob, "[", "[[]")
+}
+
+// globToLike translates a glob into a LIKE pattern escaped with a backslash
+func globToLike(glob string) string {
+	var pattern strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			pattern.WriteByte('%')
+		case '?':
+			pattern.WriteByte('_')
+		case '%', '_', '\\':
+			pattern.WriteByte('\\')
+			pattern.WriteRune(r)
+		default:
+			pattern.WriteRune(r)
+		}
+	}
+	return pattern.String()
+}
+
+// GetStagingRecordsByURLs returns the records of the URLs, keyed by URL. When stagingStorage
+// is set, only the records on that staging storage are returned.
+func GetStagingRecordsByURLs(urls []string, stagingStorage string) (map[string][]StagingRecordLite, error) {
+	query := DB.Model(&StagingRecord{}).Where("pelican_url IN ?", urls)
+	if stagingStorage != "" {
+		query = query.Where("staging_storage = ?", stagingStorage)
+	}
+
+	var records []StagingRecordLite
+	if err := query.Order("pelican_url").Order("staging_storage").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up staging records: %v", err)
+	}
+
+	byURL := make(map[string][]StagingRecordLite, len(urls))
+	for _, record := range records {
+		byURL[record.PelicanURL] = append(byURL[record.PelicanURL], record)
+	}
+	return byURL, nil
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// States of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// ErrDeliveryNotClaimed is returned when recording an attempt of a delivery this instance
+// no longer holds, because its claim expired and another instance took it over
+var ErrDeliveryNotClaimed = errors.New("webhook delivery is no longer claimed by this instance")
+
+// WebhookDelivery is a job notification to one URL, together with the outcome of its
+// latest attempt. The payload is stored as sent so that it can be replayed verbatim.
+// Each attempt is made by the instance holding the claim on the delivery, so that
+// instances sharing the database never send it twice.
+type WebhookDelivery struct {
+	ID             uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	JobID          string     `gorm:"type:varchar(255);index" json:"job_id"`
+	URL            string     `gorm:"type:text" json:"url"`
+	Event          string     `gorm:"type:varchar(64)" json:"event"`
+	Payload        string     `gorm:"type:text" json:"payload"`
+	State          string     `gorm:"type:varchar(32);index" json:"state"`
+	Attempts       int        `gorm:"type:int;default:0" json:"attempts"`
+	LastStatusCode int        `gorm:"type:int" json:"last_status_code,omitempty"` // HTTP status of the last attempt, if any
+	LastError      string     `gorm:"type:text" json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"` // Set while waiting for a retry
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	ClaimedBy      string     `gorm:"type:varchar(255)" json:"claimed_by,omitempty"` // Instance that made the latest attempt
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`                    // Set while an attempt is in flight
+}
+
+// CreateWebhookDelivery persists a new pending delivery.
+func CreateWebhookDelivery(delivery *WebhookDelivery) error {
+	if err := DB.Create(delivery).Error; err != nil {
+		return fmt.Errorf("failed to create webhook delivery for job %s: %v", delivery.JobID, err)
+	}
+	return nil
+}
+
+// ClaimWebhookDelivery takes a pending delivery that is due for its next attempt, for
+// claimDuration at most, and returns it as stored. It returns nil if the delivery is not
+// due, has finished, or is claimed by another instance whose claim has not expired.
+func ClaimWebhookDelivery(deliveryID uint, claimDuration time.Duration) (*WebhookDelivery, error) {
+	now := time.Now()
+	result := DB.Model(&WebhookDelivery{}).
+		Where("id = ? AND state = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", deliveryID, DeliveryPending, now).
+		Where("lease_expires_at IS NULL OR lease_expires_at < ? OR claimed_by = ?", now, instanceID()).
+		Updates(map[string]interface{}{
+			"claimed_by":       instanceID(),
+			"lease_expires_at": now.Add(claimDuration),
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to claim webhook delivery %d: %v", deliveryID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return GetWebhookDeliveryByID(deliveryID)
+}
+
+// RecordWebhookAttempt stores the outcome of an attempt of a delivery claimed by this
+// instance and releases the claim; nextAttemptAt is set when the delivery stays pending
+// for a retry. It returns ErrDeliveryNotClaimed if another instance took the delivery over.
+func RecordWebhookAttempt(deliveryID uint, state string, statusCode int, lastError string, nextAttemptAt *time.Time) error {
+	updates := map[string]interface{}{
+		"state":            state,
+		"attempts":         gorm.Expr("attempts + 1"),
+		"last_status_code": statusCode,
+		"last_error":       lastError,
+		"next_attempt_at":  nextAttemptAt,
+		"lease_expires_at": nil,
+	}
+	if state == DeliveryDelivered {
+		updates["delivered_at"] = time.Now()
+	}
+
+	result := DB.Model(&WebhookDelivery{}).
+		Where("id = ? AND state = ? AND claimed_by = ?", deliveryID, DeliveryPending, instanceID()).
+		Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to record attempt of webhook delivery %d: %v", deliveryID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: delivery %d", ErrDeliveryNotClaimed, deliveryID)
+	}
+	return nil
+}
+
+// ResetWebhookDelivery makes a finished delivery pending again so that it is sent once
+// more with a fresh retry budget. It reports false if the delivery is already pending,
+// so that only one caller claims it.
+func ResetWebhookDelivery(deliveryID uint) (bool, error) {
+	result := DB.Model(&WebhookDelivery{}).
+		Where("id = ? AND state <> ?", deliveryID, DeliveryPending).
+		Updates(map[string]interface{}{
+			"state":            DeliveryPending,
+			"attempts":         0,
+			"next_attempt_at":  nil,
+			"lease_expires_at": nil,
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to reset webhook delivery %d: %v", deliveryID, result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetWebhookDeliveryByID returns the delivery, or nil if it does not exist.
+func GetWebhookDeliveryByID(deliveryID uint) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	if err := DB.First(&delivery, deliveryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to retrieve webhook delivery %d: %v", deliveryID, err)
+	}
+	return &delivery, nil
+}
+
+// ListWebhookDeliveries returns deliveries, newest first, optionally restricted to a job
+// and a state.
+func ListWebhookDeliveries(jobID, state string) ([]WebhookDelivery, error) {
+	query := DB.Order("id DESC")
+	if jobID != "" {
+		query = query.Where("job_id = ?", jobID)
+	}
+	if state != "" {
+		query = query.Where("state = ?", state)
+	}
+
+	var deliveries []WebhookDelivery
+	if err := query.Find(&deliveries).Error; err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %v", err)
+	}
+	return deliveries, nil
+}
+
+// GetPendingWebhookDeliveries returns the deliveries that still have to be sent and that
+// no instance is attempting right now.
+func GetPendingWebhookDeliveries() ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := DB.Where("state = ? AND (lease_expires_at IS NULL OR lease_expires_at < ?)", DeliveryPending, time.Now()).
+		Order("id").
+		Find(&deliveries).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending webhook deliveries: %v", err)
+	}
+	return deliveries, nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"sync"
 	"time"
 
@@ -14,6 +15,7 @@ import (
 	"github.com/pelicanplatform/pelicanobjectstager/config"
 	"github.com/pelicanplatform/pelicanobjectstager/db"
 	"github.com/pelicanplatform/pelicanobjectstager/logger"
+	"github.com/pelicanplatform/pelicanobjectstager/metrics"
 )
 
 var log = logger.With(zap.String("component", "db-refresh"))
@@ -32,6 +34,11 @@ func refreshRecords() error {
 	jobID := fmt.Sprintf("refresh-records-id-%s", time.Now().Format("20060102-150405"))
 	log.Info("Starting refresh stale records job", zap.String("job_id", jobID))
 
+	start := time.Now()
+	defer func() {
+		metrics.RefreshRunDuration.Observe(time.Since(start).Seconds())
+	}()
+
 	// Step 1: Fetch stale records
 	cutoffTime := time.Now().Add(-config.AppConfig.Database.MaxRecordStaleDuration)
 	var staleRecords []db.StagingRecord
@@ -119,9 +126,11 @@ func refreshRecordWorker(recordChan <-chan db.StagingRecord, resultsChan chan<-
 		resp, err := insecureHTTPClient.Head(objectURL)
 		if err != nil {
 			log.Error("Failed to make HEAD request", zap.String("job_id", jobID), zap.Uint("recordID", record.ID), zap.Error(err))
+			metrics.RefreshHeadResults.WithLabelValues("error").Inc()
 			resultsChan <- err
 			continue
 		}
+		metrics.RefreshHeadResults.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
 
 		// Ensure the response body is closed immediately after processing
 		func() {
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "pelican_object_stager"
+
+// OtherTargetCache is the target_cache label of the caches missing from staging.cache_limits
+const OtherTargetCache = "other"
+
+var (
+	// HTTPRequests counts handled HTTP requests by route and status code
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration tracks HTTP request latency by route
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests, by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// StageRequests counts stage requests by whether they were accepted
+	StageRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stage_requests_total",
+		Help:      "Stage requests received, by result (accepted or rejected).",
+	}, []string{"result"})
+
+	// StageEntryOutcomes counts entry outcomes per target cache
+	StageEntryOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stage_entry_outcomes_total",
+		Help:      "Staging entry outcomes, by target cache (other for caches missing from staging.cache_limits) and outcome.",
+	}, []string{"target_cache", "outcome"})
+
+	// BytesStaged counts bytes successfully staged per target cache
+	BytesStaged = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_staged_total",
+		Help:      "Bytes successfully staged, by target cache (other for caches missing from staging.cache_limits).",
+	}, []string{"target_cache"})
+
+	// StagingWorkers is the size of the staging worker pool
+	StagingWorkers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "staging_workers",
+		Help:      "Number of staging workers in the pool.",
+	})
+
+	// StagingWorkersBusy is the number of workers currently staging an entry
+	StagingWorkersBusy = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "staging_workers_busy",
+		Help:      "Number of staging workers currently processing an entry.",
+	})
+
+	// PelicanInvocations counts pelican binary invocations by operation and exit code
+	PelicanInvocations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pelican_invocations_total",
+		Help:      "Pelican binary invocations, by operation and exit code.",
+	}, []string{"operation", "exit_code"})
+
+	// PelicanInvocationDuration tracks how long pelican binary invocations take
+	PelicanInvocationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "pelican_invocation_duration_seconds",
+		Help:      "Duration of pelican binary invocations, by operation.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 18), // 50ms up to ~3.6h
+	}, []string{"operation"})
+
+	// RefreshRunDuration tracks how long each database refresh run takes
+	RefreshRunDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "dbrefresh_run_duration_seconds",
+		Help:      "Duration of database refresh runs.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 14),
+	})
+
+	// RefreshHeadResults counts HEAD request results issued by the database refresh
+	RefreshHeadResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dbrefresh_head_results_total",
+		Help:      "HEAD requests issued while refreshing records, by status code (or \"error\").",
+	}, []string{"status_code"})
+)
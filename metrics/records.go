@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/db"
+	"github.com/pelicanplatform/pelicanobjectstager/logger"
+)
+
+var log = logger.With(zap.String("component", "metrics"))
+
+// recordsCollector reports the staging record counts and sizes per staging storage,
+// queried from the database at scrape time
+type recordsCollector struct {
+	count *prometheus.Desc
+	size  *prometheus.Desc
+}
+
+func newRecordsCollector() *recordsCollector {
+	return &recordsCollector{
+		count: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "staging_records"),
+			"Number of staging records, by staging storage.",
+			[]string{"staging_storage"}, nil,
+		),
+		size: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "staging_records_size_bytes"),
+			"Total object size of staging records, by staging storage.",
+			[]string{"staging_storage"}, nil,
+		),
+	}
+}
+
+func (rc *recordsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rc.count
+	ch <- rc.size
+}
+
+func (rc *recordsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := db.GetStagingStorageStats()
+	if err != nil {
+		log.Error("Failed to collect staging record metrics", zap.Error(err))
+		return
+	}
+
+	for _, stat := range stats {
+		ch <- prometheus.MustNewConstMetric(rc.count, prometheus.GaugeValue, float64(stat.RecordCount), stat.StagingStorage)
+		ch <- prometheus.MustNewConstMetric(rc.size, prometheus.GaugeValue, float64(stat.TotalSize), stat.StagingStorage)
+	}
+}
+
+func init() {
+	prometheus.MustRegister(newRecordsCollector())
+}
@@ -0,0 +1,55 @@
+package pelican
+
+import (
+	"errors"
+	"io/fs"
+	"regexp"
+)
+
+// ErrorCode is a stable category for a failed pelican invocation
+type ErrorCode string
+
+const (
+	ErrorCodeNotFound         ErrorCode = "not_found"
+	ErrorCodePermissionDenied ErrorCode = "permission_denied"
+	ErrorCodeTimeout          ErrorCode = "timeout"
+	ErrorCodeCacheUnreachable ErrorCode = "cache_unreachable"
+	ErrorCodeInvalidURL       ErrorCode = "invalid_url"
+	ErrorCodeLocalIO          ErrorCode = "local_io"
+	ErrorCodeUnknown          ErrorCode = "unknown"
+)
+
+// stderrRules are checked in order; the first matching pattern decides the category.
+// Local I/O problems come first since their messages often mention permissions too.
+var stderrRules = []struct {
+	code    ErrorCode
+	pattern *regexp.Regexp
+}{
+	{ErrorCodeLocalIO, regexp.MustCompile(`(?i)no space left on device|read-only file system|disk quota exceeded|input/output error|failed to (open|create|write) (local|destination)`)},
+	{ErrorCodeTimeout, regexp.MustCompile(`(?i)timed? ?out|deadline exceeded`)},
+	{ErrorCodePermissionDenied, regexp.MustCompile(`(?i)permission denied|forbidden|unauthori[sz]ed|\b(401|403)\b|token (is )?(invalid|expired)|authori[sz]ation (failed|required)`)},
+	{ErrorCodeNotFound, regexp.MustCompile(`(?i)not found|\b404\b|no such (file|object|namespace)|does not exist`)},
+	{ErrorCodeInvalidURL, regexp.MustCompile(`(?i)invalid url|unsupported scheme|unknown scheme|malformed|failed to parse url|missing protocol scheme`)},
+	{ErrorCodeCacheUnreachable, regexp.MustCompile(`(?i)connection refused|connection reset|no such host|network is unreachable|no route to host|dial tcp|tls handshake|\b(502|503|504)\b|unreachable`)},
+}
+
+// ClassifyFailure maps the outcome of a failed invocation to an ErrorCode using the
+// returned error, the exit code and the client's stderr.
+func ClassifyFailure(exitCode int, stderr string, err error) ErrorCode {
+	if errors.Is(err, ErrTimeout) || exitCode == ExitCodeTimeout {
+		return ErrorCodeTimeout
+	}
+
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return ErrorCodeLocalIO
+	}
+
+	for _, rule := range stderrRules {
+		if rule.pattern.MatchString(stderr) {
+			return rule.code
+		}
+	}
+
+	return ErrorCodeUnknown
+}
@@ -0,0 +1,77 @@
+package pelican
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+)
+
+// Operation identifies the kind of pelican invocation, which selects its default timeout
+type Operation string
+
+const (
+	OperationHealth    Operation = "health"
+	OperationObjectGet Operation = "object_get"
+	OperationStat      Operation = "stat"
+	OperationOther     Operation = "other"
+)
+
+// ExitCodeTimeout is reported when the binary is killed for exceeding its deadline,
+// following the convention of timeout(1)
+const ExitCodeTimeout = 124
+
+// ErrTimeout is returned when an invocation exceeds its deadline
+var ErrTimeout = errors.New("pelican invocation timed out")
+
+// OperationForArgs infers the operation type from the arguments passed to the binary
+func OperationForArgs(args []string) Operation {
+	if len(args) == 0 {
+		return OperationOther
+	}
+	if args[0] == "--version" || args[0] == "version" {
+		return OperationHealth
+	}
+	if args[0] == "object" && len(args) > 1 {
+		switch args[1] {
+		case "get":
+			return OperationObjectGet
+		case "stat":
+			return OperationStat
+		}
+	}
+	return OperationOther
+}
+
+// Timeout returns the configured default deadline for the operation; zero means none
+func (op Operation) Timeout() time.Duration {
+	timeouts := config.AppConfig.Pelican.Timeouts
+	switch op {
+	case OperationHealth:
+		return timeouts.Health
+	case OperationObjectGet:
+		return timeouts.ObjectGet
+	case OperationStat:
+		return timeouts.Stat
+	default:
+		return timeouts.Default
+	}
+}
+
+// InvokePelicanOperation runs the binary like InvokePelicanBinary, bounded by the
+// default timeout of the operation. A deadline already set on ctx still applies.
+func InvokePelicanOperation(ctx context.Context, op Operation, args []string) (string, string, int, error) {
+	return InvokePelicanOperationStreaming(ctx, op, args, StreamHandlers{})
+}
+
+// InvokePelicanOperationStreaming is the InvokePelicanBinaryStreaming counterpart of
+// InvokePelicanOperation.
+func InvokePelicanOperationStreaming(ctx context.Context, op Operation, args []string, handlers StreamHandlers) (string, string, int, error) {
+	if timeout := op.Timeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return InvokePelicanBinaryStreaming(ctx, args, handlers)
+}
@@ -2,17 +2,42 @@ package pelican
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/pelicanplatform/pelicanobjectstager/config"
+	"github.com/pelicanplatform/pelicanobjectstager/metrics"
 )
 
 // InvokePelicanBinary executes the Pelican binary with the provided arguments
-// and returns stdout and stderr as separate strings.
-func InvokePelicanBinary(args []string) (string, string, int, error) {
+// and returns stdout and stderr as separate strings. Canceling ctx kills the
+// binary along with any processes it spawned.
+func InvokePelicanBinary(ctx context.Context, args []string) (string, string, int, error) {
+	return InvokePelicanBinaryStreaming(ctx, args, StreamHandlers{})
+}
+
+// InvokePelicanBinaryStreaming works like InvokePelicanBinary and additionally hands the
+// output of the binary to handlers while it runs.
+func InvokePelicanBinaryStreaming(ctx context.Context, args []string, handlers StreamHandlers) (string, string, int, error) {
+	start := time.Now()
+	stdout, stderr, exitCode, err := runPelicanBinary(ctx, args, handlers)
+
+	operation := string(OperationForArgs(args))
+	metrics.PelicanInvocations.WithLabelValues(operation, strconv.Itoa(exitCode)).Inc()
+	metrics.PelicanInvocationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+
+	return stdout, stderr, exitCode, err
+}
+
+// runPelicanBinary does the work of InvokePelicanBinaryStreaming
+func runPelicanBinary(ctx context.Context, args []string, handlers StreamHandlers) (string, string, int, error) {
 	binaryPath := config.AppConfig.Pelican.BinaryPath
 	if binaryPath == "" {
 		return "", "", -1, fmt.Errorf("pelican binary path is not set in configuration")
@@ -23,14 +48,35 @@ func InvokePelicanBinary(args []string) (string, string, int, error) {
 		return "", "", -1, fmt.Errorf("pelican binary not found at %s: %v", binaryPath, err)
 	}
 
-	cmd := exec.Command(binaryPath, args...)
+	cmd := exec.CommandContext(ctx, binaryPath, args...)
+	setProcessGroup(cmd)
 
 	var stdoutBuf, stderrBuf bytes.Buffer
-	cmd.Stdout = &stdoutBuf
-	cmd.Stderr = &stderrBuf
+	stdoutWriters := []io.Writer{&stdoutBuf}
+	stderrWriters := []io.Writer{&stderrBuf}
+	if handlers.Stdout != nil {
+		stdoutWriters = append(stdoutWriters, handlers.Stdout)
+	}
+	if handlers.Stderr != nil {
+		stderrWriters = append(stderrWriters, handlers.Stderr)
+	}
+	if handlers.OnProgress != nil {
+		parser := &progressParser{onProgress: handlers.OnProgress}
+		stdoutWriters = append(stdoutWriters, parser.writer())
+		stderrWriters = append(stderrWriters, parser.writer())
+	}
+	cmd.Stdout = io.MultiWriter(stdoutWriters...)
+	cmd.Stderr = io.MultiWriter(stderrWriters...)
 
 	err := cmd.Run()
 	var exitCode int
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		// The process was killed because the context ended
+		if errors.Is(ctxErr, context.DeadlineExceeded) {
+			return stdoutBuf.String(), stderrBuf.String(), ExitCodeTimeout, fmt.Errorf("%w: %w", ErrTimeout, ctxErr)
+		}
+		return stdoutBuf.String(), stderrBuf.String(), -1, fmt.Errorf("pelican invocation stopped: %w", ctxErr)
+	}
 	if err != nil {
 		// Check if the error is an *exec.ExitError to extract the exit code
 		if exitError, ok := err.(*exec.ExitError); ok {
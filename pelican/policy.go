@@ -0,0 +1,136 @@
+package pelican
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+)
+
+// Rules reported by PolicyViolation
+const (
+	RuleMaxArgs           = "max_args"
+	RuleSubcommand        = "allowed_subcommands"
+	RuleForbiddenFlag     = "forbidden_flags"
+	RuleInvalidArgument   = "invalid_argument"
+	RuleLocalPathArgument = "allow_local_paths"
+)
+
+// PolicyViolation explains which passthrough rule rejected a call
+type PolicyViolation struct {
+	Rule   string
+	Detail string
+}
+
+func (v *PolicyViolation) Error() string {
+	return fmt.Sprintf("rejected by %s rule: %s", v.Rule, v.Detail)
+}
+
+// CheckPassthroughArgs validates raw arguments against the configured passthrough policy
+// and returns the violation of the first rule they break, or nil.
+func CheckPassthroughArgs(args []string) *PolicyViolation {
+	policy := config.AppConfig.Pelican.Passthrough
+
+	if policy.MaxArgs > 0 && len(args) > policy.MaxArgs {
+		return &PolicyViolation{
+			Rule:   RuleMaxArgs,
+			Detail: fmt.Sprintf("%d arguments given, at most %d allowed", len(args), policy.MaxArgs),
+		}
+	}
+
+	if !hasAllowedSubcommand(args, policy.AllowedSubcommands) {
+		return &PolicyViolation{
+			Rule:   RuleSubcommand,
+			Detail: fmt.Sprintf("%q is not an allowed subcommand; allowed: %s", strings.Join(args, " "), strings.Join(policy.AllowedSubcommands, ", ")),
+		}
+	}
+
+	for _, arg := range args {
+		if violation := checkArgument(arg); violation != nil {
+			return violation
+		}
+	}
+
+	return nil
+}
+
+// CheckStagingArgs validates what a staging request adds to the pelican calls of an
+// entry: the operands, such as the object URL and the target cache, and the parameters.
+// Parameters are held to the passthrough policy like passthrough arguments; operands must
+// not be flags. It returns the violation of the first rule they break, or nil.
+func CheckStagingArgs(operands, parameters []string) *PolicyViolation {
+	for _, operand := range operands {
+		if strings.HasPrefix(operand, "-") {
+			return &PolicyViolation{Rule: RuleInvalidArgument, Detail: fmt.Sprintf("%q is a flag, not an operand", operand)}
+		}
+		if violation := checkArgument(operand); violation != nil {
+			return violation
+		}
+	}
+
+	for _, parameter := range parameters {
+		if violation := checkArgument(parameter); violation != nil {
+			return violation
+		}
+	}
+
+	return nil
+}
+
+// checkArgument validates a single argument against the passthrough policy: it must be
+// printable, and either an allowed flag or, unless local paths are allowed, not a local path
+func checkArgument(arg string) *PolicyViolation {
+	policy := config.AppConfig.Pelican.Passthrough
+
+	if strings.IndexFunc(arg, unicode.IsControl) >= 0 {
+		return &PolicyViolation{Rule: RuleInvalidArgument, Detail: fmt.Sprintf("argument %q contains control characters", arg)}
+	}
+
+	if strings.HasPrefix(arg, "-") {
+		flag, _, _ := strings.Cut(arg, "=")
+		for _, forbidden := range policy.ForbiddenFlags {
+			if flag == forbidden {
+				return &PolicyViolation{Rule: RuleForbiddenFlag, Detail: fmt.Sprintf("flag %s is not allowed", flag)}
+			}
+		}
+		return nil
+	}
+
+	if !policy.AllowLocalPaths && looksLikeLocalPath(arg) {
+		return &PolicyViolation{Rule: RuleLocalPathArgument, Detail: fmt.Sprintf("argument %q refers to a local path", arg)}
+	}
+	return nil
+}
+
+// hasAllowedSubcommand reports whether args start with one of the allowed token sequences
+func hasAllowedSubcommand(args []string, allowed []string) bool {
+	for _, subcommand := range allowed {
+		tokens := strings.Fields(subcommand)
+		if len(tokens) == 0 || len(tokens) > len(args) {
+			continue
+		}
+
+		matches := true
+		for i, token := range tokens {
+			if args[i] != token {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// looksLikeLocalPath reports whether a positional argument names a local file
+func looksLikeLocalPath(arg string) bool {
+	return strings.HasPrefix(arg, "/") ||
+		strings.HasPrefix(arg, "./") ||
+		strings.HasPrefix(arg, "../") ||
+		strings.HasPrefix(arg, "~") ||
+		strings.HasPrefix(arg, "file:") ||
+		arg == "." || arg == ".."
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package pelican
+
+import "os/exec"
+
+// setProcessGroup is a no-op on Windows; cancellation kills only the pelican process.
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,123 @@
+package pelican
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress is a snapshot of a running transfer, parsed from the progress lines the
+// client prints, e.g. "1.50 MiB / 10.00 MiB [====>----] 15 % 2.00 MiB/s"
+type Progress struct {
+	BytesDone  int64     `json:"bytes_done"`
+	BytesTotal int64     `json:"bytes_total,omitempty"`
+	Rate       float64   `json:"rate_bytes_per_second,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// StreamHandlers observe the output of the binary while it runs. Every field is optional.
+type StreamHandlers struct {
+	Stdout     io.Writer      // Receives stdout as it is produced
+	Stderr     io.Writer      // Receives stderr as it is produced
+	OnProgress func(Progress) // Called for every progress line, never concurrently
+}
+
+var (
+	progressCounterPattern = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*([kmgtpe]i?b|b|bytes)\s*/\s*(\d+(?:\.\d+)?)\s*([kmgtpe]i?b|b|bytes)\b`)
+	progressRatePattern    = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*([kmgtpe]i?b|b)/s\b`)
+)
+
+// ParseProgressLine extracts the transfer progress from a line of client output. It
+// reports false if the line carries no byte counters.
+func ParseProgressLine(line string) (Progress, bool) {
+	counters := progressCounterPattern.FindStringSubmatch(line)
+	if counters == nil {
+		return Progress{}, false
+	}
+
+	done, ok := parseByteCount(counters[1], counters[2])
+	if !ok {
+		return Progress{}, false
+	}
+	total, ok := parseByteCount(counters[3], counters[4])
+	if !ok {
+		return Progress{}, false
+	}
+
+	progress := Progress{BytesDone: int64(done), BytesTotal: int64(total)}
+	if rate := progressRatePattern.FindStringSubmatch(line); rate != nil {
+		progress.Rate, _ = parseByteCount(rate[1], rate[2])
+	}
+	return progress, true
+}
+
+// parseByteCount converts a number with a decimal or binary size unit to bytes
+func parseByteCount(number, unit string) (float64, bool) {
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	unit = strings.ToLower(unit)
+	if unit == "b" || unit == "bytes" {
+		return value, true
+	}
+
+	base := 1000.0
+	if strings.HasSuffix(unit, "ib") {
+		base = 1024
+	}
+	exponent := strings.IndexByte("kmgtpe", unit[0]) + 1
+	for i := 0; i < exponent; i++ {
+		value *= base
+	}
+	return value, true
+}
+
+// progressParser feeds the lines written to its stream writers to a progress callback.
+// Progress bars redraw with carriage returns, so those end a line as well.
+type progressParser struct {
+	mu         sync.Mutex // Serializes the callback across stdout and stderr
+	onProgress func(Progress)
+}
+
+// writer returns a writer that parses one output stream
+func (p *progressParser) writer() io.Writer {
+	return &progressLineWriter{parser: p}
+}
+
+type progressLineWriter struct {
+	parser  *progressParser
+	partial []byte
+}
+
+func (w *progressLineWriter) Write(data []byte) (int, error) {
+	w.partial = append(w.partial, data...)
+
+	for {
+		end := bytes.IndexAny(w.partial, "\r\n")
+		if end < 0 {
+			break
+		}
+		w.parseLine(string(w.partial[:end]))
+		w.partial = w.partial[end+1:]
+	}
+
+	return len(data), nil
+}
+
+func (w *progressLineWriter) parseLine(line string) {
+	progress, ok := ParseProgressLine(line)
+	if !ok {
+		return
+	}
+	progress.UpdatedAt = time.Now()
+
+	w.parser.mu.Lock()
+	defer w.parser.mu.Unlock()
+	w.parser.onProgress(progress)
+}
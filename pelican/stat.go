@@ -0,0 +1,44 @@
+package pelican
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// statSizePattern matches the size line of the human-readable `object stat` output
+var statSizePattern = regexp.MustCompile(`(?im)^\s*"?size"?\s*[:=]\s*(\d+)`)
+
+// StatObject runs `object stat` for the URL and returns the object size reported by pelican
+// together with the raw invocation results.
+func StatObject(ctx context.Context, objectURL string) (int64, string, string, int, error) {
+	args := []string{"object", "stat", objectURL}
+
+	stdout, stderr, exitCode, err := InvokePelicanOperation(ctx, OperationStat, args)
+	if err != nil {
+		return 0, stdout, stderr, exitCode, err
+	}
+
+	size, err := ParseStatSize(stdout)
+	return size, stdout, stderr, exitCode, err
+}
+
+// ParseStatSize extracts the object size from `object stat` output, which is either a
+// JSON document or one "Key: value" pair per line depending on the client version.
+func ParseStatSize(stdout string) (int64, error) {
+	var statJSON struct {
+		Size *int64 `json:"size"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(stdout)), &statJSON); err == nil && statJSON.Size != nil {
+		return *statJSON.Size, nil
+	}
+
+	match := statSizePattern.FindStringSubmatch(stdout)
+	if match == nil {
+		return 0, fmt.Errorf("object size not found in stat output")
+	}
+	return strconv.ParseInt(match[1], 10, 64)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -36,14 +37,26 @@ func handleStartBinary(c *gin.Context) {
 		return
 	}
 
-	// Use provided arguments or default to ["default-command"]
+	// Only calls allowed by the passthrough policy reach the binary
 	args := requestBody.Args
-	if len(args) == 0 {
-		args = []string{"default-command"}
+	if violation := pelican.CheckPassthroughArgs(args); violation != nil {
+		log.Warn("PelicanBinary call rejected by policy",
+			zap.String("job_id", jobID.(string)),
+			zap.Strings("args", args),
+			zap.String("rule", violation.Rule),
+			zap.String("details", violation.Detail),
+		)
+		c.JSON(http.StatusForbidden, gin.H{
+			"job_id":  jobID, // Include Job ID
+			"error":   "Pelican invocation rejected by policy",
+			"rule":    violation.Rule,
+			"details": violation.Detail,
+		})
+		return
 	}
 
-	// Invoke the binary with the arguments
-	stdout, stderr, exitCode, err := pelican.InvokePelicanBinary(args)
+	// Invoke the binary with the arguments; a client disconnect aborts the invocation
+	stdout, stderr, exitCode, err := pelican.InvokePelicanOperation(c.Request.Context(), pelican.OperationForArgs(args), args)
 	if stderr != "" {
 		log.Error("PelicanBinary stderr",
 			zap.String("job_id", jobID.(string)),
@@ -54,15 +67,20 @@ func handleStartBinary(c *gin.Context) {
 
 	// Handle execution errors
 	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, pelican.ErrTimeout) {
+			statusCode = http.StatusGatewayTimeout
+		}
 		log.Error("Failed to execute PelicanBinary",
 			zap.String("job_id", jobID.(string)),
 			zap.Int("pelican_client_exit_code", exitCode),
 			zap.Error(err),
 			zap.String("stderr", stderr),
 		)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(statusCode, gin.H{
 			"job_id":                   jobID, // Include Job ID
 			"pelican_client_exit_code": exitCode,
+			"error_code":               pelican.ClassifyFailure(exitCode, stderr, err),
 			"error":                    "Failed to execute PelicanBinary",
 			"details":                  err.Error(),
 			"stderr":                   stderr,
@@ -89,7 +107,7 @@ func handleHealthCheck(c *gin.Context) {
 	jobID, _ := c.Get("job_id")
 
 	// Run the `--version` command on the binary
-	stdout, stderr, exitCode, err := pelican.InvokePelicanBinary([]string{"--version"})
+	stdout, stderr, exitCode, err := pelican.InvokePelicanOperation(c.Request.Context(), pelican.OperationHealth, []string{"--version"})
 
 	// Handle stderr if present
 	if stderr != "" {
@@ -102,13 +120,17 @@ func handleHealthCheck(c *gin.Context) {
 
 	// Handle errors
 	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, pelican.ErrTimeout) {
+			statusCode = http.StatusGatewayTimeout
+		}
 		log.Error("Failed to execute PelicanBinary --version",
 			zap.String("job_id", jobID.(string)),
 			zap.Int("pelican_client_exit_code", exitCode),
 			zap.Error(err),
 			zap.String("stderr", stderr),
 		)
-		c.JSON(500, gin.H{
+		c.JSON(statusCode, gin.H{
 			"job_id":                   jobID, // Include Job ID
 			"pelican_client_exit_code": exitCode,
 			"status":                   "error",
@@ -134,9 +156,21 @@ func handleHealthCheck(c *gin.Context) {
 	})
 }
 
+// handleRecordsAll lists the staging records matching the query's filters. Pages are
+// requested with limit and followed with the returned next_cursor, which is empty on the
+// last page; without a limit every matching record is returned at once.
 func handleRecordsAll(c *gin.Context) {
-	// Retrieve all records
-	records, err := db.GetStagingRecordLites()
+	filter, err := parseRecordFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	records, nextCursor, err := db.ListStagingRecordLites(filter)
+	if errors.Is(err, db.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		log.Error("Failed to retrieve all staging records",
 			zap.Error(err),
@@ -148,9 +182,13 @@ func handleRecordsAll(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"records": records,
-	})
+	}
+	if filter.Limit > 0 {
+		response["next_cursor"] = nextCursor
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func handleStagingStoragesAll(c *gin.Context) {
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/db"
+)
+
+// Page sizes of the history endpoints
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// parseHistoryFilter reads the filters and paging shared by the history endpoints
+func parseHistoryFilter(c *gin.Context) (db.HistoryFilter, error) {
+	filter := db.HistoryFilter{
+		JobID:       c.Query("job_id"),
+		RequestURL:  c.Query("request_url"),
+		TargetCache: c.Query("target_cache"),
+		State:       c.Query("state"),
+		ErrorCode:   c.Query("error_code"),
+		RequestedBy: c.Query("requested_by"),
+		Priority:    c.Query("priority"),
+		Limit:       defaultHistoryLimit,
+	}
+
+	if value := c.Query("entry_id"); value != "" {
+		entryID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return filter, fmt.Errorf("invalid entry_id: %s", value)
+		}
+		filter.EntryID = uint(entryID)
+	}
+
+	for name, target := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := c.Query(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s, expected an RFC 3339 time: %s", name, value)
+			}
+			*target = &t
+		}
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxHistoryLimit {
+			return filter, fmt.Errorf("invalid limit, expected 1 to %d: %s", maxHistoryLimit, value)
+		}
+		filter.Limit = limit
+	}
+
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return filter, fmt.Errorf("invalid offset: %s", value)
+		}
+		filter.Offset = offset
+	}
+
+	return filter, nil
+}
+
+// handleListJobs lists staging jobs, newest first, with who requested them and when
+func handleListJobs(c *gin.Context) {
+	filter, err := parseHistoryFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	jobs, total, err := db.ListStagingJobs(filter)
+	if err != nil {
+		log.Error("Failed to list staging jobs", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to list staging jobs",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+		"jobs":   jobs,
+	})
+}
+
+// handleGetJobHistory returns a staging job with every entry and every attempt of it
+func handleGetJobHistory(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	job, err := db.GetStagingJobByID(jobID)
+	if err != nil {
+		log.Error("Failed to retrieve staging job", zap.String("job_id", jobID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"job_id": jobID,
+			"error":  "Failed to retrieve the staging job",
+		})
+		return
+	}
+
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"job_id": jobID,
+			"error":  "Staging job not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// handleListAttempts lists pelican attempts, newest first, including failed ones
+func handleListAttempts(c *gin.Context) {
+	filter, err := parseHistoryFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	attempts, total, err := db.ListStagingAttempts(filter)
+	if err != nil {
+		log.Error("Failed to list staging attempts", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to list staging attempts",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":    total,
+		"limit":    filter.Limit,
+		"offset":   filter.Offset,
+		"attempts": attempts,
+	})
+}
@@ -1,11 +1,16 @@
 package server
 
 import (
+	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/pelicanplatform/pelicanobjectstager/auth"
+	"github.com/pelicanplatform/pelicanobjectstager/config"
 	"github.com/pelicanplatform/pelicanobjectstager/logger"
+	"github.com/pelicanplatform/pelicanobjectstager/metrics"
 	"go.uber.org/zap"
 )
 
@@ -13,6 +18,8 @@ var middlewares = []gin.HandlerFunc{
 	JobIDMiddleware(),
 	GinLoggerMiddleware(),
 	GinRecoveryLoggerMiddleware(),
+	MetricsMiddleware(),
+	AuthMiddleware(),
 }
 
 // JobIDMiddleware generates a unique Job ID for each request
@@ -42,6 +49,7 @@ func GinLoggerMiddleware() gin.HandlerFunc {
 
 		logger.Base().Info("Request handled",
 			zap.String("job_id", jobID.(string)),
+			zap.String("identity", auth.IdentitySubject(c)),
 			zap.String("method", c.Request.Method),
 			zap.String("path", c.Request.URL.Path),
 			zap.Int("status", statusCode),
@@ -68,3 +76,71 @@ func GinRecoveryLoggerMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// MetricsMiddleware records request counts and latencies per route
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		// Use the route template rather than the raw path to keep label cardinality bounded
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// publicRoutes are served without looking at the bearer token, so that probes and
+// scrapers keep working whatever Authorization header they send
+var publicRoutes = map[string]bool{
+	"/health":  true,
+	"/metrics": true,
+}
+
+// AuthMiddleware resolves the bearer token of the request into an identity. Requests
+// with an invalid token are rejected; requests without one continue anonymously and
+// are stopped by auth.RequireScope on protected routes. While authentication is disabled,
+// and on public routes, a verified client certificate still identifies the caller.
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.AppConfig.Server.Auth.Enabled || publicRoutes[c.FullPath()] {
+			if identity := auth.ClientCertIdentity(c.Request); identity != nil {
+				auth.SetIdentity(c, identity)
+			}
+			c.Next()
+			return
+		}
+
+		jobID := c.GetString("job_id")
+		identity, err := auth.Authenticate(c.Request)
+		if err != nil {
+			logger.Base().Warn("Authentication failed",
+				zap.String("job_id", jobID),
+				zap.String("path", c.Request.URL.Path),
+				zap.String("client_ip", c.ClientIP()),
+				zap.Error(err),
+			)
+			c.Header("WWW-Authenticate", `Bearer realm="pelican-object-stager", error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"job_id": jobID,
+				"error":  "Invalid bearer token",
+			})
+			return
+		}
+
+		if identity != nil {
+			auth.SetIdentity(c, identity)
+			logger.Base().Debug("Request authenticated",
+				zap.String("job_id", jobID),
+				zap.String("identity", identity.Subject),
+				zap.String("auth_method", identity.Method),
+			)
+		}
+
+		c.Next()
+	}
+}
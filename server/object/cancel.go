@@ -0,0 +1,265 @@
+package object
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/auth"
+	"github.com/pelicanplatform/pelicanobjectstager/db"
+	"github.com/pelicanplatform/pelicanobjectstager/pelican"
+)
+
+// runningEntry tracks an entry currently being staged so it can be cancelled
+type runningEntry struct {
+	jobID     string
+	cancel    context.CancelFunc
+	progress  *pelican.Progress // Latest transfer progress, if the client reported any
+	abandoned bool              // Killed because this process lost the entry's lease
+}
+
+// runningEntries holds the entries being staged by this process and the jobs that
+// have been cancelled while some of their entries were still in flight.
+var runningEntries = struct {
+	sync.Mutex
+	entries       map[uint]runningEntry
+	cancelledJobs map[string]struct{}
+}{
+	entries:       make(map[uint]runningEntry),
+	cancelledJobs: make(map[string]struct{}),
+}
+
+// registerRunningEntry makes a running entry cancellable. If its job was cancelled
+// while the entry was being handed to a worker, the entry is cancelled right away.
+func registerRunningEntry(entry db.StagingJobEntry, cancel context.CancelFunc) {
+	runningEntries.Lock()
+	defer runningEntries.Unlock()
+
+	runningEntries.entries[entry.ID] = runningEntry{jobID: entry.JobID, cancel: cancel}
+	if _, cancelled := runningEntries.cancelledJobs[entry.JobID]; cancelled {
+		cancel()
+	}
+}
+
+// unregisterRunningEntry forgets an entry once it has finished
+func unregisterRunningEntry(entryID uint) {
+	runningEntries.Lock()
+	defer runningEntries.Unlock()
+
+	delete(runningEntries.entries, entryID)
+}
+
+// runningEntryIDs returns the IDs of the entries being staged by this process
+func runningEntryIDs() []uint {
+	runningEntries.Lock()
+	defer runningEntries.Unlock()
+
+	entryIDs := make([]uint, 0, len(runningEntries.entries))
+	for entryID := range runningEntries.entries {
+		entryIDs = append(entryIDs, entryID)
+	}
+	return entryIDs
+}
+
+// abandonRunningEntry kills an entry whose lease this process no longer holds
+func abandonRunningEntry(entryID uint) {
+	runningEntries.Lock()
+	defer runningEntries.Unlock()
+
+	running, ok := runningEntries.entries[entryID]
+	if !ok {
+		return
+	}
+	running.abandoned = true
+	runningEntries.entries[entryID] = running
+	running.cancel()
+}
+
+// entryAbandoned reports whether a running entry was killed by abandonRunningEntry
+func entryAbandoned(entryID uint) bool {
+	runningEntries.Lock()
+	defer runningEntries.Unlock()
+
+	return runningEntries.entries[entryID].abandoned
+}
+
+// cancelRunningEntries kills every in-flight entry of the job and returns how many were signalled
+func cancelRunningEntries(jobID string) int {
+	runningEntries.Lock()
+	defer runningEntries.Unlock()
+
+	runningEntries.cancelledJobs[jobID] = struct{}{}
+
+	cancelled := 0
+	for _, running := range runningEntries.entries {
+		if running.jobID == jobID {
+			running.cancel()
+			cancelled++
+		}
+	}
+	return cancelled
+}
+
+// forgetCancelledJob drops the cancellation marker once the job has reached a final state
+func forgetCancelledJob(jobID string) {
+	runningEntries.Lock()
+	defer runningEntries.Unlock()
+
+	delete(runningEntries.cancelledJobs, jobID)
+}
+
+// uncancelledRunningJobIDs returns the jobs with entries running in this process that
+// have not been cancelled here
+func uncancelledRunningJobIDs() []string {
+	runningEntries.Lock()
+	defer runningEntries.Unlock()
+
+	seen := make(map[string]struct{})
+	var jobIDs []string
+	for _, running := range runningEntries.entries {
+		if _, cancelled := runningEntries.cancelledJobs[running.jobID]; cancelled {
+			continue
+		}
+		if _, ok := seen[running.jobID]; !ok {
+			seen[running.jobID] = struct{}{}
+			jobIDs = append(jobIDs, running.jobID)
+		}
+	}
+	return jobIDs
+}
+
+// cancelledJobIDs returns the jobs holding a cancellation marker
+func cancelledJobIDs() []string {
+	runningEntries.Lock()
+	defer runningEntries.Unlock()
+
+	jobIDs := make([]string, 0, len(runningEntries.cancelledJobs))
+	for jobID := range runningEntries.cancelledJobs {
+		jobIDs = append(jobIDs, jobID)
+	}
+	return jobIDs
+}
+
+// applyCancelRequests kills the local entries of jobs cancelled through another instance
+func applyCancelRequests() {
+	cancelled, err := db.GetCancelRequestedJobIDs(uncancelledRunningJobIDs())
+	if err != nil {
+		log.Error("Failed to check for cancelled staging jobs", zap.Error(err))
+		return
+	}
+	for _, jobID := range cancelled {
+		killed := cancelRunningEntries(jobID)
+		log.Info("Staging job cancelled by another instance",
+			zap.String("job_id", jobID),
+			zap.Int("running_entries_cancelled", killed),
+		)
+	}
+}
+
+// pruneCancelledJobs drops the markers of cancelled jobs that another instance finished,
+// since finishJobIfDone only forgets the jobs finished by this process
+func pruneCancelledJobs() {
+	jobIDs := cancelledJobIDs()
+	if len(jobIDs) == 0 {
+		return
+	}
+
+	unfinished, err := db.GetUnfinishedStagingJobIDs()
+	if err != nil {
+		log.Error("Failed to list unfinished staging jobs", zap.Error(err))
+		return
+	}
+	pending := make(map[string]struct{}, len(unfinished))
+	for _, jobID := range unfinished {
+		pending[jobID] = struct{}{}
+	}
+	for _, jobID := range jobIDs {
+		if _, ok := pending[jobID]; !ok {
+			forgetCancelledJob(jobID)
+		}
+	}
+}
+
+// HandleCancelJob cancels the queued entries of a staging job and kills the pelican
+// processes of its running entries. Entries running on other instances sharing the
+// database are killed when those instances next renew their leases.
+func HandleCancelJob(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	job, err := db.GetStagingJobByID(jobID)
+	if err != nil {
+		log.Error("Failed to retrieve staging job", zap.String("job_id", jobID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"job_id": jobID,
+			"error":  "Failed to retrieve the staging job",
+		})
+		return
+	}
+
+	if job == nil {
+		log.Info("Staging job not found", zap.String("job_id", jobID))
+		c.JSON(http.StatusNotFound, gin.H{
+			"job_id": jobID,
+			"error":  "Staging job not found",
+		})
+		return
+	}
+
+	if !authorizeJob(c, job) {
+		return
+	}
+
+	if job.State != db.StateQueued && job.State != db.StateRunning {
+		c.JSON(http.StatusConflict, gin.H{
+			"job_id": jobID,
+			"state":  job.State,
+			"error":  "Staging job has already finished",
+		})
+		return
+	}
+
+	runningCancelled, err := db.CountRunningEntries(jobID)
+	if err != nil {
+		log.Error("Failed to count running entries", zap.String("job_id", jobID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"job_id": jobID,
+			"error":  "Failed to cancel the staging job",
+		})
+		return
+	}
+
+	// Signal running entries first so an entry claimed in the meantime is caught by the job marker
+	cancelRunningEntries(jobID)
+
+	queuedCancelled, err := db.CancelQueuedEntries(jobID)
+	if err != nil {
+		log.Error("Failed to cancel queued entries", zap.String("job_id", jobID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"job_id": jobID,
+			"error":  "Failed to cancel the staging job",
+		})
+		return
+	}
+
+	log.Info("Staging job cancelled",
+		zap.String("job_id", jobID),
+		zap.String("identity", auth.IdentitySubject(c)),
+		zap.Int64("queued_entries_cancelled", queuedCancelled),
+		zap.Int64("running_entries_cancelled", runningCancelled),
+	)
+
+	// Jobs without running entries are finished right here
+	finishJobIfDone(jobID)
+	// Entries of other jobs may have taken over from cancelled entries
+	notifyQueue()
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"job_id":                    jobID,
+		"message":                   "Staging job cancellation requested",
+		"queued_entries_cancelled":  queuedCancelled,
+		"running_entries_cancelled": runningCancelled,
+	})
+}
@@ -0,0 +1,59 @@
+package object
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/db"
+	"github.com/pelicanplatform/pelicanobjectstager/metrics"
+	"github.com/pelicanplatform/pelicanobjectstager/pelican"
+)
+
+// settleAttachedEntries passes the result of a finished entry on to the entries attached
+// to it. A cancelled entry has no result to share, so one of them takes over instead.
+func settleAttachedEntries(leader db.StagingJobEntry, state string, objectSize int64, exitCode int, errorCode pelican.ErrorCode, message string) {
+	if state == db.StateCancelled {
+		promoted, err := db.PromoteAttachedEntry(leader.ID)
+		if err != nil {
+			log.Error("Failed to hand over attached entries", zap.Uint("entry_id", leader.ID), zap.Error(err))
+			return
+		}
+		if promoted != nil {
+			log.Info("Attached entry takes over from cancelled entry",
+				zap.String("job_id", promoted.JobID),
+				zap.Uint("entry_id", promoted.ID),
+				zap.Uint("cancelled_entry_id", leader.ID),
+				zap.String("request_url", promoted.RequestURL),
+			)
+			notifyQueue()
+		}
+		return
+	}
+
+	followers, err := db.FinishAttachedEntries(leader.ID, state, objectSize, exitCode, string(errorCode), message)
+	if err != nil {
+		log.Error("Failed to share result with attached entries", zap.Uint("entry_id", leader.ID), zap.Error(err))
+		return
+	}
+
+	eventType := EventFailed
+	if state == db.StateSucceeded {
+		eventType = EventCompleted
+	}
+
+	jobIDs := make(map[string]struct{})
+	for _, follower := range followers {
+		log.Info("Attached entry finished with the result of its leader",
+			zap.String("job_id", follower.JobID),
+			zap.Uint("entry_id", follower.ID),
+			zap.Uint("leader_entry_id", leader.ID),
+			zap.String("state", state),
+		)
+		metrics.StageEntryOutcomes.WithLabelValues(cacheLabel(follower.TargetCache), state).Inc()
+		publishEntryEvent(eventType, follower, state, objectSize, string(errorCode), message)
+		jobIDs[follower.JobID] = struct{}{}
+	}
+
+	for jobID := range jobIDs {
+		finishJobIfDone(jobID)
+	}
+}
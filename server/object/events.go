@@ -0,0 +1,303 @@
+package object
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/db"
+)
+
+// Types of the events streamed by HandleJobEvents
+const (
+	EventQueued      = "queued"       // Entry waiting for a worker
+	EventStarted     = "started"      // Worker started an attempt
+	EventProgress    = "progress"     // Bytes transferred by the running attempt
+	EventRetried     = "retried"      // Attempt failed transiently, entry requeued
+	EventCompleted   = "completed"    // Entry staged successfully
+	EventFailed      = "failed"       // Entry failed for good
+	EventCancelled   = "cancelled"    // Entry cancelled while staging
+	EventSkipped     = "skipped"      // Entry already staged, nothing to do
+	EventJobFinished = "job_finished" // Every entry reached a final state
+)
+
+// eventBufferSize bounds how many events a slow subscriber may lag behind before
+// further events are dropped for it
+const eventBufferSize = 64
+
+// eventKeepAlive is how often an idle stream sends a comment to keep proxies from closing it
+const eventKeepAlive = 15 * time.Second
+
+// eventPollInterval is how often a stream re-reads its job, to report the work done by
+// other instances sharing the database, whose events never reach this process's bus
+const eventPollInterval = 2 * time.Second
+
+// entryEventKey is what an event says about an entry, so that a stream reports each
+// change once whether it learned about it from the bus or from the database
+type entryEventKey struct {
+	state   string
+	attempt int
+}
+
+// JobEvent describes a state change of a staging job or one of its entries
+type JobEvent struct {
+	Type       string     `json:"type"`
+	JobID      string     `json:"job_id"`
+	EntryID    uint       `json:"entry_id,omitempty"`
+	RequestURL string     `json:"request_url,omitempty"`
+	State      string     `json:"state"`
+	Attempt    int        `json:"attempt,omitempty"`
+	Bytes      int64      `json:"bytes,omitempty"` // Bytes transferred so far, or the object size once completed
+	BytesTotal int64      `json:"bytes_total,omitempty"`
+	Rate       float64    `json:"rate_bytes_per_second,omitempty"`
+	ErrorCode  string     `json:"error_code,omitempty"`
+	Message    string     `json:"message,omitempty"`
+	RetryAt    *time.Time `json:"retry_at,omitempty"`
+	Time       time.Time  `json:"time"`
+}
+
+// eventBus fans job events out to the streams subscribed to the job. Streams are
+// closed all at once on shutdown so that they do not hold up the HTTP server.
+var eventBus = struct {
+	sync.Mutex
+	subscribers map[string]map[chan JobEvent]struct{}
+	closed      chan struct{}
+	closeOnce   sync.Once
+}{
+	subscribers: make(map[string]map[chan JobEvent]struct{}),
+	closed:      make(chan struct{}),
+}
+
+// subscribeJobEvents registers a stream for the events of a job. The returned function
+// must be called once the stream ends.
+func subscribeJobEvents(jobID string) (<-chan JobEvent, func()) {
+	events := make(chan JobEvent, eventBufferSize)
+
+	eventBus.Lock()
+	defer eventBus.Unlock()
+
+	if eventBus.subscribers[jobID] == nil {
+		eventBus.subscribers[jobID] = make(map[chan JobEvent]struct{})
+	}
+	eventBus.subscribers[jobID][events] = struct{}{}
+
+	return events, func() {
+		eventBus.Lock()
+		defer eventBus.Unlock()
+
+		delete(eventBus.subscribers[jobID], events)
+		if len(eventBus.subscribers[jobID]) == 0 {
+			delete(eventBus.subscribers, jobID)
+		}
+	}
+}
+
+// publishEvent delivers an event to the streams of its job without blocking
+func publishEvent(event JobEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	eventBus.Lock()
+	defer eventBus.Unlock()
+
+	for events := range eventBus.subscribers[event.JobID] {
+		select {
+		case events <- event:
+		default:
+			log.Warn("Event stream lagging behind, dropping event",
+				zap.String("job_id", event.JobID),
+				zap.String("event", event.Type),
+			)
+		}
+	}
+}
+
+// publishEntryEvent publishes an event about a single entry
+func publishEntryEvent(eventType string, entry db.StagingJobEntry, state string, bytes int64, errorCode, message string) {
+	publishEvent(JobEvent{
+		Type:       eventType,
+		JobID:      entry.JobID,
+		EntryID:    entry.ID,
+		RequestURL: entry.RequestURL,
+		State:      state,
+		Attempt:    entry.Attempts,
+		Bytes:      bytes,
+		ErrorCode:  errorCode,
+		Message:    message,
+	})
+}
+
+// CloseEventStreams ends every open event stream; it is meant to run on server shutdown
+func CloseEventStreams() {
+	eventBus.closeOnce.Do(func() {
+		close(eventBus.closed)
+	})
+}
+
+// snapshotEvents describes the current state of a job, so that a new stream starts from
+// what already happened
+func snapshotEvents(job *db.StagingJob) []JobEvent {
+	var events []JobEvent
+	for _, entry := range job.Entries {
+		event := JobEvent{
+			JobID:      job.ID,
+			EntryID:    entry.ID,
+			RequestURL: entry.RequestURL,
+			State:      entry.State,
+			Attempt:    entry.Attempts,
+			ErrorCode:  entry.ErrorCode,
+			Message:    entry.Message,
+			Time:       entry.UpdatedAt,
+		}
+
+		switch entry.State {
+		case db.StateQueued:
+			event.Type = EventQueued
+			event.RetryAt = entry.NextAttemptAt
+		case db.StateRunning:
+			event.Type = EventStarted
+			if progress := entryProgress(entry.ID); progress != nil {
+				event.Type = EventProgress
+				event.Bytes = progress.BytesDone
+				event.BytesTotal = progress.BytesTotal
+				event.Rate = progress.Rate
+			}
+		case db.StateSucceeded:
+			event.Type = EventCompleted
+			event.Bytes = entry.ObjectSize
+		case db.StateAlreadyStaged:
+			event.Type = EventSkipped
+			event.Bytes = entry.ObjectSize
+		case db.StateFailed:
+			event.Type = EventFailed
+		case db.StateCancelled:
+			event.Type = EventCancelled
+		default:
+			continue
+		}
+		events = append(events, event)
+	}
+
+	if jobFinished(job.State) {
+		events = append(events, jobFinishedEvent(job.ID, job.State))
+	}
+	return events
+}
+
+// jobFinished reports whether a job state is final
+func jobFinished(state string) bool {
+	return state != db.StateQueued && state != db.StateRunning
+}
+
+// jobFinishedEvent builds the last event of a job's stream
+func jobFinishedEvent(jobID, state string) JobEvent {
+	return JobEvent{
+		Type:  EventJobFinished,
+		JobID: jobID,
+		State: state,
+		Time:  time.Now(),
+	}
+}
+
+// HandleJobEvents streams the progress of a staging job as server-sent events. The stream
+// starts with the current state of every entry and ends once the job has finished. Changes
+// made by other instances are picked up by re-reading the job every eventPollInterval;
+// transfer progress is only reported for entries running in this process.
+func HandleJobEvents(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	// Subscribe before reading the job so that no event falls between the snapshot and the stream
+	events, unsubscribe := subscribeJobEvents(jobID)
+	defer unsubscribe()
+
+	job, err := db.GetStagingJobByID(jobID)
+	if err != nil {
+		log.Error("Failed to retrieve staging job", zap.String("job_id", jobID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"job_id": jobID,
+			"error":  "Failed to retrieve the staging job",
+		})
+		return
+	}
+
+	if job == nil {
+		log.Info("Staging job not found", zap.String("job_id", jobID))
+		c.JSON(http.StatusNotFound, gin.H{
+			"job_id": jobID,
+			"error":  "Staging job not found",
+		})
+		return
+	}
+
+	if !authorizeJob(c, job) {
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	pending := snapshotEvents(job)
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	poll := time.NewTicker(eventPollInterval)
+	defer poll.Stop()
+
+	// send writes the events that tell the client something new and reports whether the
+	// stream goes on. Progress from the bus is always new; the snapshots taken when
+	// polling only report entries whose state or attempt changed.
+	reported := make(map[uint]entryEventKey)
+	send := func(events []JobEvent, fromBus bool) bool {
+		for _, event := range events {
+			if event.EntryID != 0 {
+				key := entryEventKey{state: event.State, attempt: event.Attempt}
+				if reported[event.EntryID] == key && !(fromBus && event.Type == EventProgress) {
+					continue
+				}
+				reported[event.EntryID] = key
+			}
+			c.SSEvent(event.Type, event)
+			if event.Type == EventJobFinished {
+				return false
+			}
+		}
+		return true
+	}
+
+	c.Stream(func(w io.Writer) bool {
+		if len(pending) > 0 {
+			events := pending
+			pending = nil
+			return send(events, false)
+		}
+
+		select {
+		case event := <-events:
+			return send([]JobEvent{event}, true)
+		case <-poll.C:
+			job, err := db.GetStagingJobByID(jobID)
+			if err != nil {
+				// The next poll tries again
+				log.Error("Failed to refresh staging job", zap.String("job_id", jobID), zap.Error(err))
+				return true
+			}
+			if job == nil {
+				return false
+			}
+			return send(snapshotEvents(job), false)
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		case <-eventBus.closed:
+			return false
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package object
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/auth"
+	"github.com/pelicanplatform/pelicanobjectstager/db"
+	"github.com/pelicanplatform/pelicanobjectstager/pelican"
+)
+
+// EntryResult is the outcome of a single entry as reported to clients
+type EntryResult struct {
+	EntryID    uint   `json:"entry_id"`
+	RequestURL string `json:"request_url"`
+	Status     string `json:"status"`
+	ErrorCode  string `json:"error_code,omitempty"`
+	Message    string `json:"message,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+	ObjectSize int64  `json:"object_size"`
+	AttachedTo *uint  `json:"attached_to,omitempty"` // Entry whose transfer this entry shares
+
+	Progress *pelican.Progress `json:"progress,omitempty"` // Latest transfer progress while running
+}
+
+// HandleGetJob reports the state of a staging job and each of its entries
+func HandleGetJob(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	job, err := db.GetStagingJobByID(jobID)
+	if err != nil {
+		log.Error("Failed to retrieve staging job", zap.String("job_id", jobID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"job_id": jobID,
+			"error":  "Failed to retrieve the staging job",
+		})
+		return
+	}
+
+	if job == nil {
+		log.Info("Staging job not found", zap.String("job_id", jobID))
+		c.JSON(http.StatusNotFound, gin.H{
+			"job_id": jobID,
+			"error":  "Staging job not found",
+		})
+		return
+	}
+
+	if !authorizeJob(c, job) {
+		return
+	}
+
+	summary, results := entryResults(job)
+
+	// A finished job with unsuccessful entries is a multi-status result
+	statusCode := http.StatusOK
+	if job.State == db.StateFailed || job.State == db.StateCancelled {
+		statusCode = http.StatusMultiStatus
+	}
+
+	c.JSON(statusCode, gin.H{
+		"job":     job,
+		"summary": summary,
+		"results": results,
+	})
+}
+
+// authorizeJob rejects the request with 403 unless its identity requested the job or is
+// an admin. It reports whether the request may go on.
+func authorizeJob(c *gin.Context, job *db.StagingJob) bool {
+	if auth.IsOwnerOrAdmin(c, job.RequestedBy) {
+		return true
+	}
+
+	log.Warn("Request denied, staging job requested by another identity",
+		zap.String("job_id", job.ID),
+		zap.String("identity", auth.IdentitySubject(c)),
+		zap.String("requested_by", job.RequestedBy),
+	)
+	c.JSON(http.StatusForbidden, gin.H{
+		"job_id": job.ID,
+		"error":  "Staging job was requested by another identity",
+	})
+	return false
+}
+
+// entryResults reports the outcome of each entry of a job, and counts the entries in
+// each state so clients can track progress at a glance
+func entryResults(job *db.StagingJob) (map[string]int, []EntryResult) {
+	summary := make(map[string]int)
+	results := make([]EntryResult, 0, len(job.Entries))
+	for _, entry := range job.Entries {
+		summary[entry.State]++
+		results = append(results, EntryResult{
+			EntryID:    entry.ID,
+			RequestURL: entry.RequestURL,
+			Status:     entry.State,
+			ErrorCode:  entry.ErrorCode,
+			Message:    entry.Message,
+			ExitCode:   entry.PelicanExitCode,
+			ObjectSize: entry.ObjectSize,
+			AttachedTo: entry.AttachedTo,
+			Progress:   entryProgress(entry.ID),
+		})
+	}
+	return summary, results
+}
@@ -0,0 +1,62 @@
+package object
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+	"github.com/pelicanplatform/pelicanobjectstager/db"
+)
+
+// maintainLeases renews the leases of the entries running in this process and requeues
+// the entries of any instance whose lease ran out, until stopped is closed. It keeps
+// going while the workers drain, so that entries finishing their transfer stay claimed.
+// Each round also picks up the jobs cancelled through other instances.
+func maintainLeases(stopped <-chan struct{}) {
+	ticker := time.NewTicker(config.AppConfig.Staging.LeaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stopped:
+			return
+		}
+
+		renewLeases()
+		applyCancelRequests()
+		pruneCancelledJobs()
+
+		requeued, err := db.RequeueExpiredEntries()
+		if err != nil {
+			log.Error("Failed to requeue entries with an expired lease", zap.Error(err))
+		} else if requeued > 0 {
+			log.Warn("Requeued entries whose instance stopped renewing their lease", zap.Int64("entries", requeued))
+			notifyQueue()
+		}
+	}
+}
+
+// renewLeases extends the leases of the local running entries. Entries whose lease could
+// not be renewed may already be running elsewhere, so their pelican processes are killed
+// without recording a result.
+func renewLeases() {
+	entryIDs := runningEntryIDs()
+	renewed, err := db.RenewEntryLeases(entryIDs)
+	if err != nil {
+		// The leases are renewed again on the next tick, before they expire
+		log.Error("Failed to renew entry leases", zap.Error(err))
+		return
+	}
+
+	held := make(map[uint]struct{}, len(renewed))
+	for _, entryID := range renewed {
+		held[entryID] = struct{}{}
+	}
+	for _, entryID := range entryIDs {
+		if _, ok := held[entryID]; !ok {
+			abandonRunningEntry(entryID)
+		}
+	}
+}
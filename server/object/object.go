@@ -1,10 +1,19 @@
 package object
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/pelicanplatform/pelicanobjectstager/auth"
+)
 
 func RegisterObjectRoutes(router *gin.Engine) {
-	objectGroup := router.Group("/object")
+	objectGroup := router.Group("/object", auth.RequireScope(auth.ScopeStage))
 	{
 		objectGroup.POST("/stage", HandleStage)
+		objectGroup.GET("/queue", HandleGetQueue)
+		objectGroup.GET("/jobs/:job_id", HandleGetJob)
+		objectGroup.GET("/jobs/:job_id/events", HandleJobEvents)
+		objectGroup.DELETE("/jobs/:job_id", HandleCancelJob)
+		objectGroup.PUT("/jobs/:job_id/priority", auth.RequireScope(auth.ScopeAdmin), HandleSetJobPriority)
 	}
 }
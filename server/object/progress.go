@@ -0,0 +1,59 @@
+package object
+
+import (
+	"time"
+
+	"github.com/pelicanplatform/pelicanobjectstager/db"
+	"github.com/pelicanplatform/pelicanobjectstager/pelican"
+)
+
+// progressEventInterval throttles the progress events published for an entry; the latest
+// progress is still kept for status requests
+const progressEventInterval = time.Second
+
+// setEntryProgress stores the latest progress of a running entry
+func setEntryProgress(entryID uint, progress pelican.Progress) {
+	runningEntries.Lock()
+	defer runningEntries.Unlock()
+
+	running, ok := runningEntries.entries[entryID]
+	if !ok {
+		return
+	}
+	running.progress = &progress
+	runningEntries.entries[entryID] = running
+}
+
+// entryProgress returns the latest progress of a running entry, or nil if none was reported
+func entryProgress(entryID uint) *pelican.Progress {
+	runningEntries.Lock()
+	defer runningEntries.Unlock()
+
+	return runningEntries.entries[entryID].progress
+}
+
+// entryProgressHandler returns the callback that records and publishes the progress of an entry
+func entryProgressHandler(entry db.StagingJobEntry) func(pelican.Progress) {
+	var lastEvent time.Time
+
+	return func(progress pelican.Progress) {
+		setEntryProgress(entry.ID, progress)
+
+		if time.Since(lastEvent) < progressEventInterval {
+			return
+		}
+		lastEvent = time.Now()
+
+		publishEvent(JobEvent{
+			Type:       EventProgress,
+			JobID:      entry.JobID,
+			EntryID:    entry.ID,
+			RequestURL: entry.RequestURL,
+			State:      db.StateRunning,
+			Attempt:    entry.Attempts,
+			Bytes:      progress.BytesDone,
+			BytesTotal: progress.BytesTotal,
+			Rate:       progress.Rate,
+		})
+	}
+}
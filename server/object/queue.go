@@ -0,0 +1,199 @@
+package object
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+	"github.com/pelicanplatform/pelicanobjectstager/db"
+	"github.com/pelicanplatform/pelicanobjectstager/metrics"
+	"github.com/pelicanplatform/pelicanobjectstager/pelican"
+)
+
+// queueSignal wakes the dispatcher when new entries are queued
+var queueSignal = make(chan struct{}, 1)
+
+// notifyQueue tells the dispatcher that new work is available without blocking
+func notifyQueue() {
+	select {
+	case queueSignal <- struct{}{}:
+	default:
+	}
+}
+
+// killGracePeriod bounds how long shutdown waits for workers once their entries were killed
+const killGracePeriod = 10 * time.Second
+
+// workerPool tracks the staging workers so that shutdown can drain them. Entries run
+// under stagingCtx rather than the context given to StartStagingWorkers, so that
+// stopping the dispatcher does not kill the transfers in flight. stopped is closed once
+// every worker has returned.
+var workerPool struct {
+	wg         sync.WaitGroup
+	stagingCtx context.Context
+	abort      context.CancelFunc
+	stopped    chan struct{}
+}
+
+// StartStagingWorkers recovers interrupted work and launches the daemon-wide worker pool
+// that drains the persistent staging queue until ctx is canceled.
+func StartStagingWorkers(ctx context.Context) {
+	recoverInterruptedEntries()
+
+	numWorkers := config.AppConfig.Staging.Workers
+	idleWorkers := make(chan struct{}, numWorkers)
+	entryChan := make(chan db.StagingJobEntry)
+
+	workerPool.stagingCtx, workerPool.abort = context.WithCancel(context.Background())
+
+	log.Info("Starting staging workers", zap.Int("workers", numWorkers))
+	metrics.StagingWorkers.Set(float64(numWorkers))
+
+	for i := 0; i < numWorkers; i++ {
+		workerPool.wg.Add(1)
+		go func() {
+			defer workerPool.wg.Done()
+			stagingWorker(ctx, idleWorkers, entryChan)
+		}()
+	}
+
+	workerPool.stopped = make(chan struct{})
+	go func() {
+		workerPool.wg.Wait()
+		close(workerPool.stopped)
+	}()
+
+	go dispatchQueuedEntries(ctx, idleWorkers, entryChan)
+	go maintainLeases(workerPool.stopped)
+}
+
+// DrainStagingWorkers waits for the workers to finish their current entries once the context
+// given to StartStagingWorkers is canceled. Entries still running after timeout are killed,
+// together with their pelican processes, and requeued for the next start.
+func DrainStagingWorkers(timeout time.Duration) {
+	if workerPool.abort == nil {
+		return
+	}
+
+	log.Info("Draining staging workers", zap.Duration("drain_timeout", timeout))
+	select {
+	case <-workerPool.stopped:
+		log.Info("Staging workers drained")
+		return
+	case <-time.After(timeout):
+	}
+
+	log.Warn("Drain timeout reached, killing running entries", zap.Duration("drain_timeout", timeout))
+	workerPool.abort()
+
+	select {
+	case <-workerPool.stopped:
+		log.Info("Staging workers stopped")
+	case <-time.After(killGracePeriod):
+		log.Error("Staging workers did not stop after their entries were killed")
+	}
+}
+
+// stagingAborted reports whether running entries were killed by a shutdown
+func stagingAborted() bool {
+	return workerPool.stagingCtx != nil && workerPool.stagingCtx.Err() != nil
+}
+
+// recoverInterruptedEntries requeues entries that were running when the daemon last stopped,
+// shares results that were not passed on to attached entries and closes out jobs whose
+// entries all finished before their state could be recorded.
+func recoverInterruptedEntries() {
+	requeued, err := db.RequeueInterruptedEntries()
+	if err != nil {
+		log.Error("Failed to requeue interrupted entries", zap.Error(err))
+	} else if requeued > 0 {
+		log.Warn("Requeued entries interrupted by a previous shutdown", zap.Int64("entries", requeued))
+	}
+
+	leaders, err := db.GetFinishedLeaders()
+	if err != nil {
+		log.Error("Failed to list finished entries with attached entries", zap.Error(err))
+	}
+	for _, leader := range leaders {
+		settleAttachedEntries(leader, leader.State, leader.ObjectSize, leader.PelicanExitCode, pelican.ErrorCode(leader.ErrorCode), leader.Message)
+	}
+
+	jobIDs, err := db.GetUnfinishedStagingJobIDs()
+	if err != nil {
+		log.Error("Failed to list unfinished staging jobs", zap.Error(err))
+		return
+	}
+	for _, jobID := range jobIDs {
+		finishJobIfDone(jobID)
+	}
+}
+
+// dispatchQueuedEntries hands queued entries to idle workers, one at a time, taking
+// turns between target caches and respecting their limits
+func dispatchQueuedEntries(ctx context.Context, idleWorkers <-chan struct{}, entryChan chan<- db.StagingJobEntry) {
+	pollInterval := config.AppConfig.Staging.QueuePollInterval
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Only claim an entry once a worker is ready to take it
+		select {
+		case <-idleWorkers:
+		case <-ctx.Done():
+			log.Info("Stopping staging dispatcher")
+			return
+		}
+
+		for {
+			entry, err := claimNextEntry()
+			if err != nil {
+				log.Error("Failed to claim queued entry", zap.Error(err))
+			}
+			if entry != nil {
+				select {
+				case entryChan <- *entry:
+				case <-ctx.Done():
+					// The entry stays running in the database and is requeued on the next start
+					log.Info("Stopping staging dispatcher")
+					return
+				}
+				break
+			}
+
+			select {
+			case <-queueSignal:
+			case <-ticker.C:
+			case <-ctx.Done():
+				log.Info("Stopping staging dispatcher")
+				return
+			}
+		}
+	}
+}
+
+// finishJobIfDone records the aggregate result of a job once its last entry has finished
+func finishJobIfDone(jobID string) {
+	state, err := db.FinishStagingJobIfDone(jobID)
+	if err != nil {
+		log.Error("Failed to record staging job result", zap.String("job_id", jobID), zap.Error(err))
+		return
+	}
+
+	if state != "" {
+		forgetCancelledJob(jobID)
+		publishEvent(jobFinishedEvent(jobID, state))
+		notifyJobFinished(jobID)
+	}
+
+	switch state {
+	case db.StateCancelled:
+		log.Info("Staging job cancelled before completion", zap.String("job_id", jobID))
+	case db.StateFailed:
+		log.Warn("Staging completed with errors", zap.String("job_id", jobID))
+	case db.StateSucceeded:
+		log.Info("Staging completed successfully", zap.String("job_id", jobID))
+	}
+}
@@ -0,0 +1,71 @@
+package object
+
+import (
+	"math"
+	"math/rand"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+	"github.com/pelicanplatform/pelicanobjectstager/pelican"
+)
+
+var (
+	transientPatterns     []*regexp.Regexp
+	transientPatternsOnce sync.Once
+)
+
+// compiledTransientPatterns compiles the configured stderr patterns once, skipping invalid ones
+func compiledTransientPatterns() []*regexp.Regexp {
+	transientPatternsOnce.Do(func() {
+		for _, pattern := range config.AppConfig.Staging.Retry.TransientStderrPatterns {
+			re, err := regexp.Compile("(?i)" + pattern)
+			if err != nil {
+				log.Error("Ignoring invalid transient stderr pattern", zap.String("pattern", pattern), zap.Error(err))
+				continue
+			}
+			transientPatterns = append(transientPatterns, re)
+		}
+	})
+	return transientPatterns
+}
+
+// isTransientFailure reports whether a failed attempt is worth retrying, either by its
+// category or by the configured exit codes and stderr patterns
+func isTransientFailure(errorCode pelican.ErrorCode, exitCode int, stderr string) bool {
+	for _, code := range config.AppConfig.Staging.Retry.TransientErrorCodes {
+		if string(errorCode) == code {
+			return true
+		}
+	}
+	for _, code := range config.AppConfig.Staging.Retry.TransientExitCodes {
+		if exitCode == code {
+			return true
+		}
+	}
+	for _, re := range compiledTransientPatterns() {
+		if re.MatchString(stderr) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay returns the exponential backoff to wait after the given failed attempt,
+// capped at the maximum delay and randomized by the configured jitter fraction
+func retryDelay(attempt int) time.Duration {
+	retry := config.AppConfig.Staging.Retry
+
+	delay := float64(retry.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if retry.MaxDelay > 0 && delay > float64(retry.MaxDelay) {
+		delay = float64(retry.MaxDelay)
+	}
+
+	jitter := math.Min(math.Max(retry.Jitter, 0), 1)
+	delay -= delay * jitter * rand.Float64()
+
+	return time.Duration(delay)
+}
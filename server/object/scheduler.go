@@ -0,0 +1,255 @@
+package object
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/auth"
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+	"github.com/pelicanplatform/pelicanobjectstager/db"
+	"github.com/pelicanplatform/pelicanobjectstager/metrics"
+)
+
+// The dispatcher picks a priority class first and a target cache within it second.
+// Classes with work are chosen by smooth weighted round-robin on their configured
+// weights, so higher classes get most of the workers but bulk work still progresses.
+// Caches take turns in name order starting after the one served last, so a busy cache
+// cannot starve the others. Only the dispatcher goroutine touches this state.
+var scheduler = struct {
+	credits         map[string]int
+	lastServedCache string
+}{
+	credits: make(map[string]int),
+}
+
+// cacheLimit returns the maximum of concurrent entries for the target cache; zero means
+// only staging.workers applies
+func cacheLimit(targetCache string) int {
+	for _, limit := range config.AppConfig.Staging.CacheLimits {
+		if limit.Cache == targetCache {
+			return limit.MaxConcurrent
+		}
+	}
+	return config.AppConfig.Staging.DefaultCacheLimit
+}
+
+// cacheLabel returns the target_cache label of a cache in metrics. Target caches come from
+// clients, so only those listed in staging.cache_limits get a label of their own.
+func cacheLabel(targetCache string) string {
+	for _, limit := range config.AppConfig.Staging.CacheLimits {
+		if limit.Cache == targetCache {
+			return targetCache
+		}
+	}
+	return metrics.OtherTargetCache
+}
+
+// priorityWeight returns the configured weight of a priority class, at least 1
+func priorityWeight(priority string) int {
+	weights := config.AppConfig.Staging.PriorityWeights
+	weight := weights.Normal
+	switch priority {
+	case db.PriorityHigh:
+		weight = weights.High
+	case db.PriorityBulk:
+		weight = weights.Bulk
+	}
+	if weight < 1 {
+		return 1
+	}
+	return weight
+}
+
+// pickPriority chooses the next class among those with work by smooth weighted round-robin.
+// It returns the credits to keep once an entry of that class has actually been claimed, so
+// that a class found empty does not skew the rotation.
+func pickPriority(candidates map[string][]string) (string, map[string]int) {
+	credits := make(map[string]int, len(db.Priorities))
+	total := 0
+	picked := ""
+	for _, priority := range db.Priorities {
+		credits[priority] = scheduler.credits[priority]
+		if len(candidates[priority]) == 0 {
+			continue
+		}
+		weight := priorityWeight(priority)
+		total += weight
+		credits[priority] += weight
+		if picked == "" || credits[priority] > credits[picked] {
+			picked = priority
+		}
+	}
+	if picked != "" {
+		credits[picked] -= total
+	}
+	return picked, credits
+}
+
+// claimNextEntry claims an entry for the next priority class and target cache in turn,
+// skipping caches at their limit. It returns nil if nothing can be claimed right now.
+func claimNextEntry() (*db.StagingJobEntry, error) {
+	claimable, err := db.GetClaimableCaches()
+	if err != nil || len(claimable) == 0 {
+		return nil, err
+	}
+
+	running, err := db.CountRunningEntriesByCache()
+	if err != nil {
+		return nil, err
+	}
+
+	// Only caches below their limit are candidates
+	candidates := make(map[string][]string)
+	for priority, caches := range claimable {
+		for _, targetCache := range caches {
+			if limit := cacheLimit(targetCache); limit > 0 && running[targetCache] >= limit {
+				continue
+			}
+			candidates[priority] = append(candidates[priority], targetCache)
+		}
+	}
+
+	for {
+		priority, credits := pickPriority(candidates)
+		if priority == "" {
+			return nil, nil
+		}
+
+		// Rotate the sorted caches so that the one after the last served comes first. They
+		// are sorted here since the database's collation may order them differently.
+		caches := candidates[priority]
+		sort.Strings(caches)
+		start := sort.SearchStrings(caches, scheduler.lastServedCache)
+		if start < len(caches) && caches[start] == scheduler.lastServedCache {
+			start++
+		}
+		caches = append(caches[start:len(caches):len(caches)], caches[:start]...)
+
+		for _, targetCache := range caches {
+			entry, err := db.ClaimNextQueuedEntry(priority, targetCache)
+			if err != nil {
+				return nil, err
+			}
+			if entry != nil {
+				scheduler.credits = credits
+				scheduler.lastServedCache = targetCache
+				return entry, nil
+			}
+		}
+
+		// Nothing left in this class after all, try the others
+		delete(candidates, priority)
+	}
+}
+
+// CacheQueueStatus is the queue depth of a target cache together with its limit
+type CacheQueueStatus struct {
+	db.CacheQueueDepth
+	Limit int `json:"limit,omitempty"` // Maximum of concurrent entries, if capped
+}
+
+// HandleGetQueue reports how many entries wait for and run against each target cache
+func HandleGetQueue(c *gin.Context) {
+	depths, err := db.GetQueueDepthByCache()
+	if err != nil {
+		log.Error("Failed to compute queue depth", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to compute queue depth",
+		})
+		return
+	}
+
+	caches := make([]CacheQueueStatus, 0, len(depths))
+	for _, depth := range depths {
+		caches = append(caches, CacheQueueStatus{
+			CacheQueueDepth: depth,
+			Limit:           cacheLimit(depth.TargetCache),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"workers": config.AppConfig.Staging.Workers,
+		"caches":  caches,
+	})
+}
+
+// PriorityRequest is the body of the reprioritization endpoint
+type PriorityRequest struct {
+	Priority string `json:"priority" binding:"required"`
+}
+
+// HandleSetJobPriority moves the queued entries of a staging job to another priority class.
+// Entries already running are not affected.
+func HandleSetJobPriority(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	var input PriorityRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"job_id": jobID,
+			"error":  err.Error(),
+		})
+		return
+	}
+	if !db.ValidPriority(input.Priority) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"job_id": jobID,
+			"error":  "Invalid priority: " + input.Priority,
+		})
+		return
+	}
+
+	job, err := db.GetStagingJobByID(jobID)
+	if err != nil {
+		log.Error("Failed to retrieve staging job", zap.String("job_id", jobID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"job_id": jobID,
+			"error":  "Failed to retrieve the staging job",
+		})
+		return
+	}
+
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"job_id": jobID,
+			"error":  "Staging job not found",
+		})
+		return
+	}
+
+	updated, err := db.SetStagingJobPriority(jobID, input.Priority)
+	if err != nil {
+		log.Error("Failed to set staging job priority", zap.String("job_id", jobID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"job_id": jobID,
+			"error":  "Failed to set the staging job priority",
+		})
+		return
+	}
+
+	if !updated {
+		c.JSON(http.StatusConflict, gin.H{
+			"job_id": jobID,
+			"state":  job.State,
+			"error":  "Staging job has already finished",
+		})
+		return
+	}
+
+	log.Info("Staging job reprioritized",
+		zap.String("job_id", jobID),
+		zap.String("identity", auth.IdentitySubject(c)),
+		zap.String("previous_priority", job.Priority),
+		zap.String("priority", input.Priority),
+	)
+	notifyQueue()
+
+	c.JSON(http.StatusOK, gin.H{
+		"job_id":   jobID,
+		"priority": input.Priority,
+		"message":  "Staging job priority updated",
+	})
+}
@@ -1,36 +1,55 @@
 package object
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 
+	"github.com/pelicanplatform/pelicanobjectstager/auth"
 	"github.com/pelicanplatform/pelicanobjectstager/config"
 	"github.com/pelicanplatform/pelicanobjectstager/db"
 	"github.com/pelicanplatform/pelicanobjectstager/logger"
+	"github.com/pelicanplatform/pelicanobjectstager/metrics"
 	"github.com/pelicanplatform/pelicanobjectstager/pelican"
+	"github.com/pelicanplatform/pelicanobjectstager/webhook"
 )
 
 var log = logger.With(zap.String("component", "object"))
 
+// Staging modes selectable per request
+const (
+	StageModeDownload = "download" // Download into staging.temp_destination, then delete
+	StageModeDiscard  = "discard"  // Pull through the cache without writing to local disk
+)
+
 // StageRequest represents the input structure for the /object/stage endpoint
 type StageRequest struct {
-	Entries     []RequestEntry `json:"entries" binding:"required"`      // List of entries
-	TargetCache string         `json:"target_cache" binding:"required"` // Target cache
+	Entries      []RequestEntry `json:"entries" binding:"required"`      // List of entries
+	TargetCache  string         `json:"target_cache" binding:"required"` // Target cache
+	MaxRecordAge string         `json:"max_record_age,omitempty"`        // Overrides database.max_record_stale_duration, e.g. "1h"
+	Mode         string         `json:"mode,omitempty"`                  // Staging mode, defaults to download
+	CallbackURL  string         `json:"callback_url,omitempty"`          // Receives a signed POST when the job finishes
+	Priority     string         `json:"priority,omitempty"`              // high, normal or bulk, defaults to normal
 }
 
 // RequestEntry represents a single request entry
 type RequestEntry struct {
 	RequestURL string `json:"request_url" binding:"required"` // Object URL
 	Parameters string `json:"parameters,omitempty"`           // Optional flags/options
+	Force      bool   `json:"force,omitempty"`                // Stage even if a fresh record exists
+	KeepLocal  bool   `json:"keep_local,omitempty"`           // Keep the downloaded copy in staging.temp_destination
 }
 
+// HandleStage queues the entries of a staging job for the background workers.
+// The response is returned immediately; progress is available through HandleGetJob.
 func HandleStage(c *gin.Context) {
 	var input StageRequest
 
@@ -44,160 +63,548 @@ func HandleStage(c *gin.Context) {
 
 	if err := c.ShouldBindJSON(&input); err != nil {
 		log.Error("Failed to bind JSON input", zap.String("job_id", jobID), zap.Error(err))
+		metrics.StageRequests.WithLabelValues("rejected").Inc()
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	numWorkers := config.AppConfig.Staging.Workers
-	entryChan := make(chan RequestEntry, len(input.Entries))
-	resultsChan := make(chan map[string]interface{}, len(input.Entries))
-	var wg sync.WaitGroup
+	maxRecordAge := config.AppConfig.Database.MaxRecordStaleDuration
+	if input.MaxRecordAge != "" {
+		var err error
+		maxRecordAge, err = time.ParseDuration(input.MaxRecordAge)
+		if err != nil || maxRecordAge < 0 {
+			log.Error("Invalid max_record_age", zap.String("job_id", jobID), zap.String("max_record_age", input.MaxRecordAge))
+			metrics.StageRequests.WithLabelValues("rejected").Inc()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid max_record_age: " + input.MaxRecordAge})
+			return
+		}
+	}
+
+	mode := input.Mode
+	if mode == "" {
+		mode = StageModeDownload
+	}
+	if mode != StageModeDownload && mode != StageModeDiscard {
+		log.Error("Invalid staging mode", zap.String("job_id", jobID), zap.String("mode", input.Mode))
+		metrics.StageRequests.WithLabelValues("rejected").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mode: " + input.Mode})
+		return
+	}
+
+	priority := input.Priority
+	if priority == "" {
+		priority = db.PriorityNormal
+	}
+	if !db.ValidPriority(priority) {
+		log.Error("Invalid priority", zap.String("job_id", jobID), zap.String("priority", input.Priority))
+		metrics.StageRequests.WithLabelValues("rejected").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid priority: " + input.Priority})
+		return
+	}
 
-	// Start staging workers
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go stagingWorker(entryChan, input.TargetCache, resultsChan, &wg, jobID)
+	if input.CallbackURL != "" {
+		if err := webhook.CheckCallbackURL(input.CallbackURL); err != nil {
+			log.Error("Invalid callback_url", zap.String("job_id", jobID), zap.String("callback_url", input.CallbackURL), zap.Error(err))
+			metrics.StageRequests.WithLabelValues("rejected").Inc()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid callback_url: " + err.Error()})
+			return
+		}
 	}
 
-	// Send entries to the workers
+	// Request URLs, the target cache and parameters end up on pelican command lines
 	for _, entry := range input.Entries {
-		entryChan <- entry
+		violation := pelican.CheckStagingArgs([]string{entry.RequestURL, input.TargetCache}, strings.Fields(entry.Parameters))
+		if violation != nil {
+			log.Warn("Staging entry rejected by policy",
+				zap.String("job_id", jobID),
+				zap.String("request_url", entry.RequestURL),
+				zap.String("parameters", entry.Parameters),
+				zap.String("rule", violation.Rule),
+				zap.String("details", violation.Detail),
+			)
+			metrics.StageRequests.WithLabelValues("rejected").Inc()
+			c.JSON(http.StatusBadRequest, gin.H{
+				"job_id":      jobID,
+				"error":       "policy_violation",
+				"request_url": entry.RequestURL,
+				"rule":        violation.Rule,
+				"details":     violation.Detail,
+			})
+			return
+		}
 	}
-	close(entryChan)
 
-	// Wait for all workers to complete
-	wg.Wait()
-	close(resultsChan)
+	job := db.StagingJob{
+		ID:           jobID,
+		CallbackURL:  input.CallbackURL,
+		RequestedBy:  auth.IdentitySubject(c),
+		Priority:     priority,
+		TargetCache:  input.TargetCache,
+		Mode:         mode,
+		State:        db.StateQueued,
+		TotalEntries: len(input.Entries),
+	}
+	if identity := auth.GetIdentity(c); identity != nil {
+		job.AuthMethod = identity.Method
+	}
 
-	results := make(map[string]interface{})
-	hasErrors := false
+	alreadyStaged := 0
+	for _, entry := range input.Entries {
+		jobEntry := db.StagingJobEntry{
+			TargetCache: input.TargetCache,
+			RequestURL:  entry.RequestURL,
+			Parameters:  entry.Parameters,
+			Mode:        mode,
+			Priority:    priority,
+			KeepLocal:   entry.KeepLocal,
+			State:       db.StateQueued,
+		}
 
-	for result := range resultsChan {
-		url := result["request_url"].(string)
-		status := result["result"]
+		if !entry.Force {
+			record, err := db.GetFreshStagingRecord(entry.RequestURL, input.TargetCache, maxRecordAge)
+			if err != nil {
+				log.Error("Failed to look up staging record",
+					zap.String("job_id", jobID),
+					zap.String("request_url", entry.RequestURL),
+					zap.Error(err),
+				)
+			} else if record != nil {
+				now := time.Now()
+				jobEntry.State = db.StateAlreadyStaged
+				jobEntry.ObjectSize = record.ObjectSize
+				jobEntry.FinishedAt = &now
+				alreadyStaged++
 
-		results[url] = status
-		if status != "success" {
-			hasErrors = true
+				log.Info("Entry already staged, skipping",
+					zap.String("job_id", jobID),
+					zap.String("request_url", entry.RequestURL),
+					zap.Time("record_updated_at", record.UpdatedAt),
+				)
+			}
 		}
+
+		job.Entries = append(job.Entries, jobEntry)
 	}
 
-	// Determine response status
-	if hasErrors {
-		log.Warn("Staging completed with errors", zap.String("job_id", jobID))
+	if err := db.CreateStagingJob(&job); err != nil {
+		log.Error("Failed to persist staging job", zap.String("job_id", jobID), zap.Error(err))
+		metrics.StageRequests.WithLabelValues("rejected").Inc()
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"job_id":  jobID,
-			"message": "Staging completed with errors",
-			"results": results,
+			"job_id": jobID,
+			"error":  "Failed to create staging job",
 		})
+		return
+	}
+
+	attached := 0
+	for _, entry := range job.Entries {
+		if entry.State == db.StateQueued {
+			publishEntryEvent(EventQueued, entry, entry.State, 0, "", "")
+		}
+		if entry.AttachedTo != nil {
+			attached++
+		}
+	}
+
+	metrics.StageRequests.WithLabelValues("accepted").Inc()
+	metrics.StageEntryOutcomes.WithLabelValues(cacheLabel(input.TargetCache), db.StateAlreadyStaged).Add(float64(alreadyStaged))
+
+	if alreadyStaged == len(job.Entries) {
+		// Nothing to stage, so the job is complete already
+		finishJobIfDone(jobID)
 	} else {
-		log.Info("Staging completed successfully", zap.String("job_id", jobID))
-		c.JSON(http.StatusOK, gin.H{
-			"job_id":  jobID,
-			"message": "Staging completed successfully",
-			"results": results,
-		})
+		notifyQueue()
+	}
+
+	statusURL := "/object/jobs/" + jobID
+	log.Info("Staging job accepted",
+		zap.String("job_id", jobID),
+		zap.String("identity", auth.IdentitySubject(c)),
+		zap.String("target_cache", input.TargetCache),
+		zap.String("priority", priority),
+		zap.Int("entries", len(input.Entries)),
+		zap.Int("already_staged", alreadyStaged),
+		zap.Int("attached", attached),
+	)
+	c.Header("Location", statusURL)
+	c.JSON(http.StatusAccepted, gin.H{
+		"job_id":         jobID,
+		"message":        "Staging job accepted",
+		"status_url":     statusURL,
+		"already_staged": alreadyStaged,
+		"attached":       attached,
+	})
+}
+
+// stagingWorker processes queued entries handed over by the dispatcher and records
+// their outcome in the database. It stops taking entries once ctx is canceled.
+func stagingWorker(ctx context.Context, idleWorkers chan<- struct{}, entries <-chan db.StagingJobEntry) {
+	for {
+		idleWorkers <- struct{}{}
+
+		var entry db.StagingJobEntry
+		select {
+		case entry = <-entries:
+		case <-ctx.Done():
+			return
+		}
+
+		metrics.StagingWorkersBusy.Inc()
+		stageEntry(workerPool.stagingCtx, entry)
+		metrics.StagingWorkersBusy.Dec()
+
+		// The finished entry may have freed a slot of a cache at its limit
+		notifyQueue()
 	}
 }
 
-// stagingWorker processes a single entry and sends results to channels
-func stagingWorker(entries <-chan RequestEntry, targetCache string, results chan<- map[string]interface{}, wg *sync.WaitGroup, jobID string) {
-	defer wg.Done()
+// stageEntry pulls a single entry through the target cache and records its size. In
+// download mode the object lands in a temporary file that is removed afterwards unless
+// the entry asked to keep it; in discard mode the bytes are thrown away and the size
+// comes from `object stat`.
+func stageEntry(ctx context.Context, entry db.StagingJobEntry) {
+	jobID := entry.JobID
+	targetCache := entry.TargetCache
+	discard := entry.Mode == StageModeDiscard
+
+	if err := db.MarkStagingJobRunning(jobID); err != nil {
+		log.Error("Failed to update staging job state", zap.String("job_id", jobID), zap.Error(err))
+	}
+
+	publishEntryEvent(EventStarted, entry, db.StateRunning, 0, "", "")
 
-	tempObjectName := uuid.New().String()
-	tempDestination := config.AppConfig.Staging.TempDestination
-	objectDestination := filepath.Join(tempDestination, tempObjectName)
+	entryCtx, cancel := context.WithCancel(ctx)
+	registerRunningEntry(entry, cancel)
+	defer func() {
+		unregisterRunningEntry(entry.ID)
+		cancel()
+	}()
 
-	for entry := range entries {
-		args := []string{"object", "get", entry.RequestURL, objectDestination}
+	var parameterArgs []string
+	if entry.Parameters != "" {
+		parameterArgs = strings.Fields(entry.Parameters) // Split by space
+	}
+
+	var statSize int64
+	objectDestination := os.DevNull
+	if discard {
+		var stdout, stderr string
+		var exitCode int
+		var err error
+		// The parameters are meant for `object get`, which accepts flags `object stat` does not
+		statSize, stdout, stderr, exitCode, err = pelican.StatObject(entryCtx, entry.RequestURL)
+		if err != nil {
+			failEntry(entry, "Failed to stat object", stdout, stderr, exitCode, err)
+			return
+		}
+	} else {
+		// Every entry gets its own temporary file so concurrent and consecutive entries never collide
+		objectDestination = filepath.Join(config.AppConfig.Staging.TempDestination, uuid.New().String())
+		if err := db.SetStagingJobEntryLocalPath(entry.ID, objectDestination); err != nil {
+			log.Error("Failed to record local object destination",
+				zap.String("job_id", jobID),
+				zap.Uint("entry_id", entry.ID),
+				zap.Error(err),
+			)
+		}
+	}
 
-		if entry.Parameters != "" {
-			parameterArgs := strings.Fields(entry.Parameters) // Split by space
-			args = append(args, parameterArgs...)
+	keepLocal := false
+	defer func() {
+		if !discard && !keepLocal {
+			removeTempObject(entry, objectDestination)
 		}
+	}()
+
+	args := []string{"object", "get", entry.RequestURL, objectDestination}
+	args = append(args, parameterArgs...)
+	args = append(args, "--cache", targetCache)
+
+	log.Debug("Processing entry",
+		zap.String("job_id", jobID),
+		zap.Uint("entry_id", entry.ID),
+		zap.String("request_url", entry.RequestURL),
+		zap.String("parameters", entry.Parameters),
+		zap.String("mode", entry.Mode),
+		zap.Strings("parsed_args", args),
+		zap.String("local_object_destination", objectDestination),
+	)
+
+	stdout, stderr, exitCode, err := pelican.InvokePelicanOperationStreaming(entryCtx, pelican.OperationObjectGet, args, pelican.StreamHandlers{
+		OnProgress: entryProgressHandler(entry),
+	})
+	if err != nil {
+		failEntry(entry, "Failed to process entry", stdout, stderr, exitCode, err)
+		return
+	}
 
-		args = append(args, "--cache", targetCache)
+	objectSize := statSize
+	if !discard {
+		objectInfo, err := os.Stat(objectDestination)
+		if err != nil {
+			failEntry(entry, "Failed to process entry", stdout, stderr, exitCode, err)
+			return
+		}
+		objectSize = objectInfo.Size()
+	}
 
-		log.Debug("Processing entry",
+	err = db.FinishStagedEntry(entry, objectSize, exitCode, stdout, stderr)
+	if errors.Is(err, db.ErrEntryNotClaimed) {
+		dropLostEntry(entry)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to insert staging record",
 			zap.String("job_id", jobID),
 			zap.String("request_url", entry.RequestURL),
-			zap.String("parameters", entry.Parameters),
-			zap.Strings("parsed_args", args),
-			zap.String("temp_destination", tempDestination),
-			zap.String("local_object_destination", objectDestination),
+			zap.Int64("object_size_in_bytes", objectSize),
+			zap.String("stdout", stdout),
+			zap.String("stderr", stderr),
+			zap.Int("pelican_client_exit_code", exitCode),
+			zap.Error(err),
 		)
+		finishEntry(entry, db.StateFailed, objectSize, exitCode, stderr, pelican.ErrorCodeUnknown, err.Error())
+		return
+	}
 
-		stdout, stderr, exitCode, err := pelican.InvokePelicanBinary(args)
+	keepLocal = entry.KeepLocal && !discard
 
-		if err != nil {
-			errorMessage := stderr
-			// If stderr is empty, use the default error message
-			if stderr == "" {
-				errorMessage = err.Error()
-			}
+	log.Info("Entry processed successfully",
+		zap.String("job_id", jobID),
+		zap.String("request_url", entry.RequestURL),
+		zap.String("mode", entry.Mode),
+		zap.Int64("object_size_in_bytes", objectSize),
+		zap.String("stdout", stdout),
+		zap.String("stderr", stderr),
+		zap.Int("pelican_client_exit_code", exitCode),
+		zap.Bool("keep_local", keepLocal),
+	)
+	entryFinished(entry, db.StateSucceeded, objectSize, exitCode, stderr, "", "")
+}
 
-			log.Error("Failed to process entry",
-				zap.String("job_id", jobID),
-				zap.String("request_url", entry.RequestURL),
-				zap.String("stdout", stdout),
-				zap.String("stderr", stderr),
-				zap.String("local_object_destination", objectDestination),
-				zap.String("error", errorMessage),
-				zap.Int("pelican_client_exit_code", exitCode),
-			)
-			results <- map[string]interface{}{
-				"request_url": entry.RequestURL,
-				"result":      errorMessage,
-			}
-		} else {
-			objectInfo, err := os.Stat(objectDestination)
-			if err != nil {
-				log.Error("Failed to process entry",
-					zap.String("job_id", jobID),
-					zap.String("request_url", entry.RequestURL),
-					zap.String("stdout", stdout),
-					zap.String("stderr", stderr),
-					zap.String("local_object_destination", objectDestination),
-					zap.String("error", err.Error()),
-					zap.Int("pelican_client_exit_code", exitCode),
-				)
-				results <- map[string]interface{}{
-					"request_url": entry.RequestURL,
-					"result":      err.Error(),
-				}
-			}
-			objectSize := objectInfo.Size()
+// failEntry records an entry whose pelican invocation did not succeed. Cancellations are
+// told apart from failures, and transient failures are retried while attempts remain.
+func failEntry(entry db.StagingJobEntry, msg, stdout, stderr string, exitCode int, err error) {
+	jobID := entry.JobID
 
-			err = db.InsertOrUpdateStagingRecord(entry.RequestURL, targetCache, jobID, objectSize, exitCode, stdout, stderr)
-			if err == nil {
-				log.Info("Entry processed successfully",
-					zap.String("job_id", jobID),
-					zap.String("request_url", entry.RequestURL),
-					zap.Int64("object_size_in_bytes", objectSize),
-					zap.String("stdout", stdout),
-					zap.String("stderr", stderr),
-					zap.Int("pelican_client_exit_code", exitCode),
-				)
-				results <- map[string]interface{}{
-					"request_url": entry.RequestURL,
-					"result":      "success",
-				}
-			} else {
-				log.Error("Failed to insert staging record",
-					zap.String("job_id", jobID),
-					zap.String("request_url", entry.RequestURL),
-					zap.Int64("object_size_in_bytes", objectSize),
-					zap.String("stdout", stdout),
-					zap.String("stderr", stderr),
-					zap.Int("pelican_client_exit_code", exitCode),
-					zap.Error(err),
-				)
-				results <- map[string]interface{}{
-					"request_url": entry.RequestURL,
-					"result":      err.Error(),
-				}
-			}
+	if errors.Is(err, context.Canceled) && stagingAborted() {
+		requeueInterruptedEntry(entry)
+		return
+	}
+
+	if errors.Is(err, context.Canceled) && entryAbandoned(entry.ID) {
+		dropLostEntry(entry)
+		return
+	}
 
+	if errors.Is(err, context.Canceled) {
+		log.Info("Entry cancelled while staging",
+			zap.String("job_id", jobID),
+			zap.String("request_url", entry.RequestURL),
+			zap.Int("pelican_client_exit_code", exitCode),
+		)
+		finishEntry(entry, db.StateCancelled, 0, exitCode, stderr, "", "Cancelled while staging")
+		return
+	}
+
+	errorMessage := stderr
+	// If stderr is empty, use the default error message
+	if stderr == "" {
+		errorMessage = err.Error()
+	}
+	errorCode := pelican.ClassifyFailure(exitCode, stderr, err)
+
+	log.Error(msg,
+		zap.String("job_id", jobID),
+		zap.String("request_url", entry.RequestURL),
+		zap.Int("attempt", entry.Attempts),
+		zap.String("error_code", string(errorCode)),
+		zap.String("stdout", stdout),
+		zap.String("stderr", stderr),
+		zap.String("error", errorMessage),
+		zap.Int("pelican_client_exit_code", exitCode),
+	)
+
+	if entry.Attempts < config.AppConfig.Staging.Retry.MaxAttempts && isTransientFailure(errorCode, exitCode, stderr) {
+		retryEntry(entry, exitCode, stderr, errorCode, errorMessage)
+		return
+	}
+
+	finishEntry(entry, db.StateFailed, 0, exitCode, stderr, errorCode, errorMessage)
+}
+
+// retryEntry records the failed attempt and puts the entry back in the queue after a backoff
+func retryEntry(entry db.StagingJobEntry, exitCode int, stderr string, errorCode pelican.ErrorCode, message string) {
+	delay := retryDelay(entry.Attempts)
+
+	if err := db.RequeueEntryForRetry(entry.ID, time.Now().Add(delay), string(errorCode), message); err != nil {
+		if errors.Is(err, db.ErrEntryNotClaimed) {
+			dropLostEntry(entry)
+			return
 		}
+		log.Error("Failed to requeue entry for retry, giving up",
+			zap.String("job_id", entry.JobID),
+			zap.Uint("entry_id", entry.ID),
+			zap.Error(err),
+		)
+		finishEntry(entry, db.StateFailed, 0, exitCode, stderr, errorCode, message)
+		return
 	}
+	recordAttempt(entry, db.StateFailed, true, exitCode, stderr, errorCode, message)
+	metrics.StageEntryOutcomes.WithLabelValues(cacheLabel(entry.TargetCache), "retried").Inc()
+
+	retryAt := time.Now().Add(delay)
+	publishEvent(JobEvent{
+		Type:       EventRetried,
+		JobID:      entry.JobID,
+		EntryID:    entry.ID,
+		RequestURL: entry.RequestURL,
+		State:      db.StateQueued,
+		Attempt:    entry.Attempts,
+		ErrorCode:  string(errorCode),
+		Message:    message,
+		RetryAt:    &retryAt,
+	})
+
+	log.Warn("Transient failure, entry will be retried",
+		zap.String("job_id", entry.JobID),
+		zap.Uint("entry_id", entry.ID),
+		zap.String("request_url", entry.RequestURL),
+		zap.Int("attempt", entry.Attempts),
+		zap.Duration("retry_in", delay),
+	)
+
+	// Wake the dispatcher as soon as the entry becomes due
+	time.AfterFunc(delay, notifyQueue)
+}
+
+// requeueInterruptedEntry puts an entry killed by a shutdown back in the queue so that it
+// starts over on the next start, without counting the interrupted attempt
+func requeueInterruptedEntry(entry db.StagingJobEntry) {
+	err := db.RequeueInterruptedEntry(entry.ID)
+	if errors.Is(err, db.ErrEntryNotClaimed) {
+		dropLostEntry(entry)
+		return
+	}
+
+	recordAttempt(entry, db.AttemptInterrupted, false, 0, "", "", "Interrupted by shutdown")
+	if err != nil {
+		// Entries left running are requeued on the next start anyway
+		log.Error("Failed to requeue entry interrupted by shutdown",
+			zap.String("job_id", entry.JobID),
+			zap.Uint("entry_id", entry.ID),
+			zap.Error(err),
+		)
+		return
+	}
+
+	log.Warn("Entry interrupted by shutdown, requeued",
+		zap.String("job_id", entry.JobID),
+		zap.Uint("entry_id", entry.ID),
+		zap.String("request_url", entry.RequestURL),
+	)
+}
+
+// recordAttempt stores the outcome of the entry's current attempt
+func recordAttempt(entry db.StagingJobEntry, state string, retried bool, exitCode int, stderr string, errorCode pelican.ErrorCode, message string) {
+	attempt := db.StagingAttempt{
+		EntryID:         entry.ID,
+		JobID:           entry.JobID,
+		RequestURL:      entry.RequestURL,
+		TargetCache:     entry.TargetCache,
+		Attempt:         entry.Attempts,
+		State:           state,
+		Retried:         retried,
+		PelicanExitCode: exitCode,
+		ErrorCode:       string(errorCode),
+		PelicanStderr:   stderr,
+		Message:         message,
+		StartedAt:       entry.StartedAt,
+		FinishedAt:      time.Now(),
+	}
+	if err := db.CreateStagingAttempt(&attempt); err != nil {
+		log.Error("Failed to record attempt",
+			zap.String("job_id", entry.JobID),
+			zap.Uint("entry_id", entry.ID),
+			zap.Int("attempt", entry.Attempts),
+			zap.Error(err),
+		)
+	}
+}
+
+// removeTempObject deletes the temporary copy of an entry, which may be partial or absent
+func removeTempObject(entry db.StagingJobEntry, objectDestination string) {
+	if err := os.Remove(objectDestination); err != nil && !os.IsNotExist(err) {
+		log.Error("Failed to remove temporary object",
+			zap.String("job_id", entry.JobID),
+			zap.Uint("entry_id", entry.ID),
+			zap.String("local_object_destination", objectDestination),
+			zap.Error(err),
+		)
+		return
+	}
+
+	if err := db.SetStagingJobEntryLocalPath(entry.ID, ""); err != nil {
+		log.Error("Failed to clear local object destination",
+			zap.String("job_id", entry.JobID),
+			zap.Uint("entry_id", entry.ID),
+			zap.Error(err),
+		)
+	}
+}
+
+// finishEntry records the outcome of an entry, logging if the update fails, unless another
+// instance took the entry over in the meantime
+func finishEntry(entry db.StagingJobEntry, state string, objectSize int64, exitCode int, stderr string, errorCode pelican.ErrorCode, message string) {
+	err := db.FinishStagingJobEntry(entry.ID, state, objectSize, exitCode, string(errorCode), message)
+	if errors.Is(err, db.ErrEntryNotClaimed) {
+		dropLostEntry(entry)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to record entry result",
+			zap.String("job_id", entry.JobID),
+			zap.Uint("entry_id", entry.ID),
+			zap.String("state", state),
+			zap.Error(err),
+		)
+	}
+
+	entryFinished(entry, state, objectSize, exitCode, stderr, errorCode, message)
+}
+
+// entryFinished follows up on an entry whose outcome was stored: it records the final
+// attempt, publishes the outcome and settles the job and the entries attached to it
+func entryFinished(entry db.StagingJobEntry, state string, objectSize int64, exitCode int, stderr string, errorCode pelican.ErrorCode, message string) {
+	recordAttempt(entry, state, false, exitCode, stderr, errorCode, message)
+
+	metrics.StageEntryOutcomes.WithLabelValues(cacheLabel(entry.TargetCache), state).Inc()
+	if state == db.StateSucceeded {
+		metrics.BytesStaged.WithLabelValues(cacheLabel(entry.TargetCache)).Add(float64(objectSize))
+	}
+
+	eventType := EventFailed
+	switch state {
+	case db.StateSucceeded:
+		eventType = EventCompleted
+	case db.StateCancelled:
+		eventType = EventCancelled
+	}
+	publishEntryEvent(eventType, entry, state, objectSize, string(errorCode), message)
+
+	finishJobIfDone(entry.JobID)
+	settleAttachedEntries(entry, state, objectSize, exitCode, errorCode, message)
+}
+
+// dropLostEntry gives up on an attempt whose entry was requeued after its lease expired.
+// The entry belongs to whichever instance claims it next, so the outcome of this attempt
+// is not passed on; the attempt is only recorded as interrupted.
+func dropLostEntry(entry db.StagingJobEntry) {
+	log.Warn("Entry lost its lease while staging, dropping the result of the attempt",
+		zap.String("job_id", entry.JobID),
+		zap.Uint("entry_id", entry.ID),
+		zap.String("request_url", entry.RequestURL),
+		zap.Int("attempt", entry.Attempts),
+	)
+	recordAttempt(entry, db.AttemptInterrupted, false, 0, "", "", "Lease lost while staging")
 }
@@ -0,0 +1,93 @@
+package object
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+	"github.com/pelicanplatform/pelicanobjectstager/db"
+	"github.com/pelicanplatform/pelicanobjectstager/webhook"
+)
+
+// JobNotification is the payload POSTed to webhooks when a staging job finishes
+type JobNotification struct {
+	Event       string        `json:"event"`
+	JobID       string        `json:"job_id"`
+	State       string        `json:"state"`
+	TargetCache string        `json:"target_cache"`
+	Mode        string        `json:"mode"`
+	CreatedAt   time.Time     `json:"created_at"`
+	FinishedAt  *time.Time    `json:"finished_at,omitempty"`
+	Totals      JobTotals     `json:"totals"`
+	Results     []EntryResult `json:"results"`
+}
+
+// JobTotals sums up the entries of a finished job
+type JobTotals struct {
+	Entries     int            `json:"entries"`
+	States      map[string]int `json:"states"`       // Number of entries in each state
+	BytesStaged int64          `json:"bytes_staged"` // Size of the objects staged by this job
+}
+
+// webhookURLs returns the configured webhooks followed by the job's callback, without duplicates
+func webhookURLs(callbackURL string) []string {
+	seen := make(map[string]struct{})
+	var urls []string
+	for _, u := range append(append([]string{}, config.AppConfig.Webhooks.URLs...), callbackURL) {
+		if u == "" {
+			continue
+		}
+		if _, ok := seen[u]; ok {
+			continue
+		}
+		seen[u] = struct{}{}
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+// notifyJobFinished sends the result of a finished job to its webhooks
+func notifyJobFinished(jobID string) {
+	job, err := db.GetStagingJobByID(jobID)
+	if err != nil || job == nil {
+		log.Error("Failed to load finished staging job for notification", zap.String("job_id", jobID), zap.Error(err))
+		return
+	}
+
+	urls := webhookURLs(job.CallbackURL)
+	if len(urls) == 0 {
+		return
+	}
+
+	summary, results := entryResults(job)
+	var bytesStaged int64
+	for _, entry := range job.Entries {
+		if entry.State == db.StateSucceeded {
+			bytesStaged += entry.ObjectSize
+		}
+	}
+
+	payload, err := json.Marshal(JobNotification{
+		Event:       webhook.EventJobFinished,
+		JobID:       job.ID,
+		State:       job.State,
+		TargetCache: job.TargetCache,
+		Mode:        job.Mode,
+		CreatedAt:   job.CreatedAt,
+		FinishedAt:  job.FinishedAt,
+		Totals: JobTotals{
+			Entries:     len(job.Entries),
+			States:      summary,
+			BytesStaged: bytesStaged,
+		},
+		Results: results,
+	})
+	if err != nil {
+		log.Error("Failed to encode job notification", zap.String("job_id", jobID), zap.Error(err))
+		return
+	}
+
+	webhook.Notify(jobID, webhook.EventJobFinished, urls, payload)
+}
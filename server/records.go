@@ -0,0 +1,205 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+	"github.com/pelicanplatform/pelicanobjectstager/db"
+)
+
+// Largest page of GET /records/all; without a limit every matching record is returned
+const maxRecordsLimit = 10000
+
+// Most URLs accepted by one POST /records/lookup
+const maxLookupURLs = 1000
+
+// LookupRequest is the body of POST /records/lookup
+type LookupRequest struct {
+	URLs         []string `json:"urls" binding:"required"`  // Pelican URLs to look up
+	Cache        string   `json:"cache,omitempty"`          // Only consider this cache
+	MaxRecordAge string   `json:"max_record_age,omitempty"` // Overrides database.max_record_stale_duration, e.g. "1h"
+}
+
+// RecordLookup tells where an object is staged. Staged is set when at least one cache
+// holds a fresh copy, i.e. one that staging would not fetch again.
+type RecordLookup struct {
+	URL    string           `json:"url"`
+	Staged bool             `json:"staged"`
+	Caches []RecordLocation `json:"caches"`
+}
+
+// RecordLocation describes the copy of an object on one cache
+type RecordLocation struct {
+	Cache      string    `json:"cache"`
+	ObjectSize int64     `json:"object_size"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Fresh      bool      `json:"fresh"` // Updated within the max record age
+}
+
+// parseRecordFilter reads the filters, sort and paging of GET /records/all
+func parseRecordFilter(c *gin.Context) (db.RecordFilter, error) {
+	filter := db.RecordFilter{
+		StagingStorage: c.Query("staging_storage"),
+		URLPrefix:      c.Query("url_prefix"),
+		URLGlob:        c.Query("url_glob"),
+		JobID:          c.Query("job_id"),
+		SortBy:         c.DefaultQuery("sort", "id"),
+		Cursor:         c.Query("cursor"),
+	}
+
+	for name, target := range map[string]**int64{"min_size": &filter.MinSize, "max_size": &filter.MaxSize} {
+		if value := c.Query(name); value != "" {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return filter, fmt.Errorf("invalid %s, expected a number of bytes: %s", name, value)
+			}
+			*target = &size
+		}
+	}
+
+	for name, target := range map[string]**time.Time{"updated_after": &filter.UpdatedAfter, "updated_before": &filter.UpdatedBefore} {
+		if value := c.Query(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s, expected an RFC 3339 time: %s", name, value)
+			}
+			*target = &t
+		}
+	}
+
+	if !db.ValidRecordSort(filter.SortBy) {
+		return filter, fmt.Errorf("invalid sort, expected one of %s: %s", strings.Join(db.RecordSortColumns, ", "), filter.SortBy)
+	}
+
+	switch order := c.DefaultQuery("order", "asc"); order {
+	case "asc":
+	case "desc":
+		filter.Descending = true
+	default:
+		return filter, fmt.Errorf("invalid order, expected asc or desc: %s", order)
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxRecordsLimit {
+			return filter, fmt.Errorf("invalid limit, expected 1 to %d: %s", maxRecordsLimit, value)
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+// parseMaxRecordAge returns the age up to which a record counts as fresh
+func parseMaxRecordAge(value string) (time.Duration, error) {
+	if value == "" {
+		return config.AppConfig.Database.MaxRecordStaleDuration, nil
+	}
+	maxAge, err := time.ParseDuration(value)
+	if err != nil || maxAge < 0 {
+		return 0, fmt.Errorf("invalid max_record_age: %s", value)
+	}
+	return maxAge, nil
+}
+
+// lookupRecords reports, in the order of the URLs, which caches have each one staged
+func lookupRecords(urls []string, cache string, maxAge time.Duration) ([]RecordLookup, error) {
+	byURL, err := db.GetStagingRecordsByURLs(urls, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	lookups := make([]RecordLookup, 0, len(urls))
+	for _, url := range urls {
+		lookup := RecordLookup{URL: url, Caches: []RecordLocation{}}
+		for _, record := range byURL[url] {
+			location := RecordLocation{
+				Cache:      record.StagingStorage,
+				ObjectSize: record.ObjectSize,
+				UpdatedAt:  record.UpdatedAt,
+				Fresh:      !record.UpdatedAt.Before(cutoff),
+			}
+			lookup.Staged = lookup.Staged || location.Fresh
+			lookup.Caches = append(lookup.Caches, location)
+		}
+		lookups = append(lookups, lookup)
+	}
+	return lookups, nil
+}
+
+// handleLookupRecord tells which caches have the object given by the url query parameter
+// staged, optionally only the one given by cache
+func handleLookupRecord(c *gin.Context) {
+	url := c.Query("url")
+	if url == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url is required"})
+		return
+	}
+	maxAge, err := parseMaxRecordAge(c.Query("max_record_age"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lookups, err := lookupRecords([]string{url}, c.Query("cache"), maxAge)
+	if err != nil {
+		log.Error("Failed to look up staging records", zap.String("url", url), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to look up records",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, lookups[0])
+}
+
+// handleLookupRecords is the bulk form of handleLookupRecord, answering for every URL of
+// the request in order
+func handleLookupRecords(c *gin.Context) {
+	var input LookupRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+	if len(input.URLs) > maxLookupURLs {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Too many urls, at most %d per request", maxLookupURLs),
+		})
+		return
+	}
+	for _, url := range input.URLs {
+		if url == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "urls must not be empty"})
+			return
+		}
+	}
+	maxAge, err := parseMaxRecordAge(input.MaxRecordAge)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lookups, err := lookupRecords(input.URLs, input.Cache, maxAge)
+	if err != nil {
+		log.Error("Failed to look up staging records", zap.Int("urls", len(input.URLs)), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to look up records",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results": lookups,
+	})
+}
@@ -2,50 +2,148 @@ package server
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 
+	"github.com/pelicanplatform/pelicanobjectstager/auth"
 	"github.com/pelicanplatform/pelicanobjectstager/config"
+	"github.com/pelicanplatform/pelicanobjectstager/db"
 	"github.com/pelicanplatform/pelicanobjectstager/dbrefresh"
 	"github.com/pelicanplatform/pelicanobjectstager/logger"
 	"github.com/pelicanplatform/pelicanobjectstager/server/object"
+	"github.com/pelicanplatform/pelicanobjectstager/tempcleanup"
+	"github.com/pelicanplatform/pelicanobjectstager/webhook"
 )
 
 var log = logger.With(zap.String("component", "server"))
 
 func StartServer() {
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Background tasks run until SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	r := gin.New()
 
 	for _, mw := range middlewares {
 		r.Use(mw)
 	}
-	r.POST("/pelican", handleStartBinary)
 	r.GET("/health", handleHealthCheck)
-	r.GET("/records/all", handleRecordsAll)
-	r.GET("/records/stagingstorages/all", handleStagingStoragesAll)
-	r.GET("/records/:id", handleGetRecordByID)
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.POST("/pelican", auth.RequireScope(auth.ScopeAdmin), handleStartBinary)
+
+	recordsGroup := r.Group("/records", auth.RequireScope(auth.ScopeReadRecords))
+	{
+		recordsGroup.GET("/all", handleRecordsAll)
+		recordsGroup.GET("/stagingstorages/all", handleStagingStoragesAll)
+		recordsGroup.GET("/lookup", handleLookupRecord)
+		recordsGroup.POST("/lookup", handleLookupRecords)
+		recordsGroup.GET("/:id", handleGetRecordByID)
+	}
+
+	historyGroup := r.Group("/history", auth.RequireScope(auth.ScopeReadRecords))
+	{
+		historyGroup.GET("/jobs", handleListJobs)
+		historyGroup.GET("/jobs/:job_id", handleGetJobHistory)
+		historyGroup.GET("/attempts", handleListAttempts)
+	}
+
+	webhooksGroup := r.Group("/webhooks", auth.RequireScope(auth.ScopeAdmin))
+	{
+		webhooksGroup.GET("/deliveries", handleListWebhookDeliveries)
+		webhooksGroup.GET("/deliveries/:id", handleGetWebhookDelivery)
+		webhooksGroup.POST("/deliveries/:id/replay", handleReplayWebhookDelivery)
+	}
 
 	object.RegisterObjectRoutes(r)
 
 	address := config.AppConfig.Server.Port
 
+	// Deliveries start first as recovering the staging queue may finish jobs
+	log.Debug("Starting webhook deliveries...")
+	webhook.StartDeliveries(ctx)
+
+	log.Debug("Starting staging workers...")
+	object.StartStagingWorkers(ctx)
+
 	log.Debug("Starting LaunchPeriodicRefreshRecords...")
 	go dbrefresh.LaunchPeriodicRefreshRecords(ctx)
 
-	log.Info("Starting server",
-		zap.Int("port", address),
-	)
+	log.Debug("Starting LaunchPeriodicTempCleanup...")
+	go tempcleanup.LaunchPeriodicTempCleanup(ctx)
+
+	srv := &http.Server{
+		Addr:    ":" + strconv.Itoa(address),
+		Handler: r,
+	}
+	// Event streams stay open until their job finishes, so end them before waiting on requests
+	srv.RegisterOnShutdown(object.CloseEventStreams)
+
+	serveErr := make(chan error, 1)
+	if tlsEnabled() {
+		reloader, reloaderErr := newCertReloader()
+		if reloaderErr != nil {
+			log.Fatal("Failed to load TLS configuration", zap.Error(reloaderErr))
+		}
+		reloader.reloadOnSIGHUP()
+		srv.TLSConfig = reloader.tlsConfig()
 
-	port := strconv.Itoa(address)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server",
-			zap.Error(err),
+		log.Info("Starting server",
+			zap.Int("port", address),
+			zap.Bool("tls", true),
+			zap.Bool("client_certificates_required", config.AppConfig.Server.TLS.ClientCAFile != ""),
+		)
+		go func() { serveErr <- srv.ListenAndServeTLS("", "") }()
+	} else {
+		log.Info("Starting server",
+			zap.Int("port", address),
+			zap.Bool("tls", false),
 		)
+		go func() { serveErr <- srv.ListenAndServe() }()
 	}
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server",
+				zap.Error(err),
+			)
+		}
+	case <-ctx.Done():
+		log.Info("Shutdown signal received")
+	}
+	stop()
+
+	shutdown(srv)
+}
+
+// shutdown stops accepting requests, lets running staging entries finish within the
+// drain timeout and closes the database. Background tasks have already been stopped
+// through the canceled context.
+func shutdown(srv *http.Server) {
+	deadline := time.Now().Add(config.AppConfig.Staging.DrainTimeout)
+
+	shutdownCtx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	log.Info("Stopping HTTP server")
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error("Failed to stop HTTP server gracefully", zap.Error(err))
+	}
+
+	object.DrainStagingWorkers(time.Until(deadline))
+
+	if err := db.CloseDB(); err != nil {
+		log.Error("Failed to close database", zap.Error(err))
+	}
+
+	log.Info("Shutdown complete")
 }
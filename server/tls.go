@@ -0,0 +1,123 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+)
+
+// certReloader serves the configured certificate and client CAs, swapping them in place
+// when reloaded so that the listener never has to be restarted
+type certReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// tlsEnabled reports whether the server should serve HTTPS
+func tlsEnabled() bool {
+	tlsConfig := config.AppConfig.Server.TLS
+	return tlsConfig.CertFile != "" && tlsConfig.KeyFile != ""
+}
+
+func newCertReloader() (*certReloader, error) {
+	tlsConfig := config.AppConfig.Server.TLS
+	cr := &certReloader{
+		certFile:     tlsConfig.CertFile,
+		keyFile:      tlsConfig.KeyFile,
+		clientCAFile: tlsConfig.ClientCAFile,
+	}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// reload reads the certificate, key and client CAs from disk. On error the previously
+// loaded material stays in use.
+func (cr *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load server certificate: %v", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if cr.clientCAFile != "" {
+		caPEM, err := os.ReadFile(cr.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %v", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("no certificates found in client CA file %s", cr.clientCAFile)
+		}
+	}
+
+	cr.mu.Lock()
+	cr.cert = &cert
+	cr.clientCAs = clientCAs
+	cr.mu.Unlock()
+	return nil
+}
+
+// getCertificate returns the currently loaded server certificate
+func (cr *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// tlsConfig returns a TLS configuration whose certificate and client CAs are looked up
+// per handshake. NextProtos is set up front because the per-handshake configuration is
+// cloned from this one and http.Server only adds h2 to its own copy.
+func (cr *certReloader) tlsConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: cr.getCertificate,
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cr.mu.RLock()
+		defer cr.mu.RUnlock()
+
+		handshakeConfig := base.Clone()
+		handshakeConfig.GetConfigForClient = nil
+		if cr.clientCAs != nil {
+			handshakeConfig.ClientCAs = cr.clientCAs
+			handshakeConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		return handshakeConfig, nil
+	}
+	return base
+}
+
+// reloadOnSIGHUP reloads the certificates every time the process receives SIGHUP
+func (cr *certReloader) reloadOnSIGHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			if err := cr.reload(); err != nil {
+				log.Error("Failed to reload TLS certificates, keeping the previous ones", zap.Error(err))
+				continue
+			}
+			log.Info("TLS certificates reloaded",
+				zap.String("cert_file", cr.certFile),
+				zap.String("client_ca_file", cr.clientCAFile),
+			)
+		}
+	}()
+}
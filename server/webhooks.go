@@ -0,0 +1,115 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/auth"
+	"github.com/pelicanplatform/pelicanobjectstager/db"
+	"github.com/pelicanplatform/pelicanobjectstager/webhook"
+)
+
+// handleListWebhookDeliveries lists webhook deliveries, optionally filtered by job_id and state
+func handleListWebhookDeliveries(c *gin.Context) {
+	jobID := c.Query("job_id")
+	state := c.Query("state")
+
+	deliveries, err := db.ListWebhookDeliveries(jobID, state)
+	if err != nil {
+		log.Error("Failed to list webhook deliveries", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to list webhook deliveries",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// parseDeliveryID reads the delivery ID from the URL, answering 400 if it is malformed
+func parseDeliveryID(c *gin.Context) (uint, bool) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		log.Error("Invalid ID format",
+			zap.String("id", idParam),
+			zap.Error(err),
+		)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid ID format",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func handleGetWebhookDelivery(c *gin.Context) {
+	id, ok := parseDeliveryID(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := db.GetWebhookDeliveryByID(id)
+	if err != nil {
+		log.Error("Failed to retrieve webhook delivery",
+			zap.Uint("id", id),
+			zap.Error(err),
+		)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve the webhook delivery",
+		})
+		return
+	}
+
+	if delivery == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Webhook delivery not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// handleReplayWebhookDelivery sends a delivered or failed notification again
+func handleReplayWebhookDelivery(c *gin.Context) {
+	id, ok := parseDeliveryID(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := webhook.Replay(id)
+	if errors.Is(err, webhook.ErrDeliveryPending) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Webhook delivery is still pending",
+		})
+		return
+	}
+	if err != nil {
+		log.Error("Failed to replay webhook delivery",
+			zap.Uint("id", id),
+			zap.Error(err),
+		)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to replay the webhook delivery",
+		})
+		return
+	}
+
+	if delivery == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Webhook delivery not found",
+		})
+		return
+	}
+
+	log.Info("Webhook delivery replay requested",
+		zap.Uint("id", id),
+		zap.String("identity", auth.IdentitySubject(c)),
+	)
+	c.JSON(http.StatusAccepted, delivery)
+}
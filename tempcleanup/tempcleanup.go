@@ -0,0 +1,117 @@
+package tempcleanup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+	"github.com/pelicanplatform/pelicanobjectstager/db"
+	"github.com/pelicanplatform/pelicanobjectstager/logger"
+)
+
+var log = logger.With(zap.String("component", "temp-cleanup"))
+
+// cleanupTempDestination removes orphaned files from the staging temp directory that are
+// older than the configured maximum age. Copies of running entries and copies kept on
+// request are left alone.
+func cleanupTempDestination() error {
+	tempDestination := config.AppConfig.Staging.TempDestination
+	maxAge := config.AppConfig.Staging.TempMaxAge
+
+	protectedPaths, err := db.GetProtectedLocalPaths()
+	if err != nil {
+		return err
+	}
+	protected := make(map[string]struct{}, len(protectedPaths))
+	for _, path := range protectedPaths {
+		protected[filepath.Clean(path)] = struct{}{}
+	}
+
+	dirEntries, err := os.ReadDir(tempDestination)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Debug("Temp destination does not exist, nothing to clean up", zap.String("temp_destination", tempDestination))
+			return nil
+		}
+		return err
+	}
+
+	cutoffTime := time.Now().Add(-maxAge)
+	removed := 0
+	var reclaimedBytes int64
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(tempDestination, dirEntry.Name())
+		if _, ok := protected[path]; ok {
+			continue
+		}
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			// The file vanished between listing and stat
+			continue
+		}
+		if info.ModTime().After(cutoffTime) {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Error("Failed to remove orphaned temp file", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		removed++
+		reclaimedBytes += info.Size()
+		log.Debug("Removed orphaned temp file", zap.String("path", path), zap.Time("modified_at", info.ModTime()))
+	}
+
+	log.Info("Temp cleanup completed",
+		zap.String("temp_destination", tempDestination),
+		zap.Int("files_removed", removed),
+		zap.Int64("bytes_reclaimed", reclaimedBytes),
+	)
+	return nil
+}
+
+// LaunchPeriodicTempCleanup sweeps the temp directory once at startup and then
+// periodically until ctx is canceled. An interval of 0 disables the cleanup.
+func LaunchPeriodicTempCleanup(ctx context.Context) {
+	cleanupInterval := config.AppConfig.Staging.TempCleanupInterval
+	if cleanupInterval <= 0 {
+		log.Info("Temp cleanup disabled", zap.Duration("interval", cleanupInterval))
+		return
+	}
+
+	log.Info("Launching periodic temp cleanup",
+		zap.Duration("interval", cleanupInterval),
+		zap.Duration("max_age", config.AppConfig.Staging.TempMaxAge),
+	)
+
+	go func() {
+		if err := cleanupTempDestination(); err != nil {
+			log.Error("Error occurred during temp cleanup", zap.Error(err))
+		}
+
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				log.Info("Periodic temp cleanup triggered")
+				if err := cleanupTempDestination(); err != nil {
+					log.Error("Error occurred during temp cleanup", zap.Error(err))
+				}
+			case <-ctx.Done():
+				log.Info("Stopping periodic temp cleanup")
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+)
+
+// sharedAddressSpace is the carrier-grade NAT range, which net.IP.IsPrivate does not cover
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// callbackClient sends the deliveries to job callback URLs. Those are chosen by clients, so
+// unless webhooks.allow_private_callbacks is set it refuses to connect to internal
+// addresses, checked after name resolution, and it neither follows redirects nor uses a proxy.
+var callbackClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 30 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				if config.AppConfig.Webhooks.AllowPrivateCallbacks {
+					return nil
+				}
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || internalIP(ip) {
+					return fmt.Errorf("callback address %s is not public", host)
+				}
+				return nil
+			},
+		}).DialContext,
+		ForceAttemptHTTP2:   true,
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// CheckCallbackURL validates a job's callback_url: an absolute http or https URL whose host
+// matches webhooks.callback_hosts, when set, and is not an internal address literal.
+func CheckCallbackURL(callbackURL string) error {
+	parsed, err := url.Parse(callbackURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return fmt.Errorf("expected an absolute http or https URL")
+	}
+	host := strings.ToLower(parsed.Hostname())
+
+	if allowed := config.AppConfig.Webhooks.CallbackHosts; len(allowed) > 0 && !matchHost(allowed, host) {
+		return fmt.Errorf("host %s is not in webhooks.callback_hosts", host)
+	}
+	if config.AppConfig.Webhooks.AllowPrivateCallbacks {
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("host %s is not public", host)
+	}
+	if ip := net.ParseIP(host); ip != nil && internalIP(ip) {
+		return fmt.Errorf("host %s is not public", host)
+	}
+	return nil
+}
+
+// matchHost reports whether the host matches one of the patterns, e.g. "*.example.org"
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// internalIP reports whether the address is loopback, link-local, private or otherwise
+// not reachable on the public internet
+func internalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() || sharedAddressSpace.Contains(ip)
+}
+
+// clientFor returns the client for a delivery; only the operator's webhooks.urls may
+// reach internal addresses
+func clientFor(deliveryURL string) *http.Client {
+	for _, configured := range config.AppConfig.Webhooks.URLs {
+		if deliveryURL == configured {
+			return http.DefaultClient
+		}
+	}
+	return callbackClient
+}
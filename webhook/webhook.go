@@ -0,0 +1,363 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/pelicanplatform/pelicanobjectstager/config"
+	"github.com/pelicanplatform/pelicanobjectstager/db"
+	"github.com/pelicanplatform/pelicanobjectstager/logger"
+)
+
+var log = logger.With(zap.String("component", "webhook"))
+
+// EventJobFinished is sent once every entry of a staging job reached a final state
+const EventJobFinished = "job.finished"
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Pelican-Stager-Event"
+	HeaderDelivery  = "X-Pelican-Stager-Delivery"
+	HeaderSignature = "X-Pelican-Stager-Signature" // "sha256=" followed by the hex HMAC of the body
+)
+
+// ErrDeliveryPending is returned when replaying a delivery that is still being attempted
+var ErrDeliveryPending = errors.New("webhook delivery is still pending")
+
+// pendingPollInterval is how often pending deliveries nobody is attempting are picked up,
+// such as those left behind by a stopped instance sharing the database
+const pendingPollInterval = time.Minute
+
+// claimMargin is added to the request timeout to get how long an attempt keeps its claim
+const claimMargin = time.Minute
+
+// deliveryCtx bounds the background delivery loops; deliveries interrupted by a shutdown
+// stay pending and are resumed by StartDeliveries on the next start
+var deliveryCtx = context.Background()
+
+// inFlight holds the deliveries handled by a delivery loop of this process
+var inFlight = struct {
+	sync.Mutex
+	deliveries map[uint]struct{}
+}{
+	deliveries: make(map[uint]struct{}),
+}
+
+// StartDeliveries resumes the deliveries left pending by a previous process, then keeps
+// picking up pending deliveries nobody attempts. Deliveries stop retrying once ctx is
+// canceled.
+func StartDeliveries(ctx context.Context) {
+	deliveryCtx = ctx
+
+	if config.AppConfig.Webhooks.Secret == "" {
+		log.Warn("webhooks.secret is not set, webhook payloads will not be signed")
+	}
+
+	go func() {
+		ticker := time.NewTicker(pendingPollInterval)
+		defer ticker.Stop()
+
+		for {
+			resumePendingDeliveries()
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// resumePendingDeliveries starts a delivery loop for every pending delivery that neither
+// this process nor another instance is attempting
+func resumePendingDeliveries() {
+	deliveries, err := db.GetPendingWebhookDeliveries()
+	if err != nil {
+		log.Error("Failed to resume pending webhook deliveries", zap.Error(err))
+		return
+	}
+
+	resumed := 0
+	for _, delivery := range deliveries {
+		if trackDelivery(delivery.ID) {
+			resumed++
+			go deliver(delivery)
+		}
+	}
+	if resumed > 0 {
+		log.Info("Resuming pending webhook deliveries", zap.Int("deliveries", resumed))
+	}
+}
+
+// trackDelivery registers a delivery loop and reports false if one is running already
+func trackDelivery(deliveryID uint) bool {
+	inFlight.Lock()
+	defer inFlight.Unlock()
+
+	if _, ok := inFlight.deliveries[deliveryID]; ok {
+		return false
+	}
+	inFlight.deliveries[deliveryID] = struct{}{}
+	return true
+}
+
+// untrackDelivery forgets a delivery loop once it has returned
+func untrackDelivery(deliveryID uint) {
+	inFlight.Lock()
+	defer inFlight.Unlock()
+
+	delete(inFlight.deliveries, deliveryID)
+}
+
+// Notify records one delivery of the payload per URL and sends them in the background
+func Notify(jobID, event string, urls []string, payload []byte) {
+	for _, url := range urls {
+		delivery := db.WebhookDelivery{
+			JobID:   jobID,
+			URL:     url,
+			Event:   event,
+			Payload: string(payload),
+			State:   db.DeliveryPending,
+		}
+		if err := db.CreateWebhookDelivery(&delivery); err != nil {
+			log.Error("Failed to record webhook delivery",
+				zap.String("job_id", jobID),
+				zap.String("url", url),
+				zap.Error(err),
+			)
+			continue
+		}
+		if trackDelivery(delivery.ID) {
+			go deliver(delivery)
+		}
+	}
+}
+
+// Replay sends a finished delivery again with a fresh retry budget. It returns nil if the
+// delivery does not exist.
+func Replay(deliveryID uint) (*db.WebhookDelivery, error) {
+	delivery, err := db.GetWebhookDeliveryByID(deliveryID)
+	if err != nil || delivery == nil {
+		return nil, err
+	}
+	if delivery.State == db.DeliveryPending {
+		return delivery, ErrDeliveryPending
+	}
+
+	// Claim the delivery, so that concurrent replays do not send it twice
+	claimed, err := db.ResetWebhookDelivery(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return delivery, ErrDeliveryPending
+	}
+	delivery.State = db.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = nil
+
+	log.Info("Replaying webhook delivery",
+		zap.Uint("delivery_id", delivery.ID),
+		zap.String("job_id", delivery.JobID),
+		zap.String("url", delivery.URL),
+	)
+	if trackDelivery(delivery.ID) {
+		go deliver(*delivery)
+	}
+
+	return delivery, nil
+}
+
+// deliver attempts a pending delivery until it succeeds or runs out of attempts. Every
+// attempt is claimed first, so that the loop stops as soon as another instance sharing
+// the database handles the delivery. The delivery must have been registered with
+// trackDelivery.
+func deliver(delivery db.WebhookDelivery) {
+	defer untrackDelivery(delivery.ID)
+	settings := config.AppConfig.Webhooks
+
+	if delivery.NextAttemptAt != nil {
+		if !wait(time.Until(*delivery.NextAttemptAt)) {
+			return
+		}
+	}
+
+	for {
+		// Deliveries left pending by a shutdown are resumed with their remaining attempts
+		if deliveryCtx.Err() != nil {
+			return
+		}
+
+		claimed, err := db.ClaimWebhookDelivery(delivery.ID, settings.Timeout+claimMargin)
+		if err != nil {
+			// The delivery stays pending and is picked up again by resumePendingDeliveries
+			log.Error("Failed to claim webhook delivery", zap.Uint("delivery_id", delivery.ID), zap.Error(err))
+			return
+		}
+		if claimed == nil {
+			log.Debug("Webhook delivery handled elsewhere", zap.Uint("delivery_id", delivery.ID))
+			return
+		}
+		delivery = *claimed
+
+		attempts := delivery.Attempts + 1
+		statusCode, err := send(delivery)
+		if err != nil && deliveryCtx.Err() != nil {
+			log.Info("Webhook delivery interrupted by shutdown, will resume on restart",
+				zap.Uint("delivery_id", delivery.ID),
+				zap.String("job_id", delivery.JobID),
+			)
+			return
+		}
+		if err == nil {
+			if !recordAttempt(delivery, db.DeliveryDelivered, statusCode, "", nil) {
+				return
+			}
+			log.Info("Webhook delivered",
+				zap.Uint("delivery_id", delivery.ID),
+				zap.String("job_id", delivery.JobID),
+				zap.String("url", delivery.URL),
+				zap.Int("attempt", attempts),
+				zap.Int("status_code", statusCode),
+			)
+			return
+		}
+
+		if attempts >= settings.MaxAttempts {
+			if !recordAttempt(delivery, db.DeliveryFailed, statusCode, err.Error(), nil) {
+				return
+			}
+			log.Error("Webhook delivery failed, giving up",
+				zap.Uint("delivery_id", delivery.ID),
+				zap.String("job_id", delivery.JobID),
+				zap.String("url", delivery.URL),
+				zap.Int("attempt", attempts),
+				zap.Error(err),
+			)
+			return
+		}
+
+		delay := retryDelay(attempts)
+		nextAttemptAt := time.Now().Add(delay)
+		if !recordAttempt(delivery, db.DeliveryPending, statusCode, err.Error(), &nextAttemptAt) {
+			return
+		}
+		log.Warn("Webhook delivery failed, will retry",
+			zap.Uint("delivery_id", delivery.ID),
+			zap.String("job_id", delivery.JobID),
+			zap.String("url", delivery.URL),
+			zap.Int("attempt", attempts),
+			zap.Duration("retry_in", delay),
+			zap.Error(err),
+		)
+
+		if !wait(delay) {
+			return
+		}
+	}
+}
+
+// recordAttempt stores the outcome of an attempt and reports whether the delivery loop may
+// go on. It stops the loop when another instance took the delivery over.
+func recordAttempt(delivery db.WebhookDelivery, state string, statusCode int, lastError string, nextAttemptAt *time.Time) bool {
+	err := db.RecordWebhookAttempt(delivery.ID, state, statusCode, lastError, nextAttemptAt)
+	if errors.Is(err, db.ErrDeliveryNotClaimed) {
+		log.Warn("Webhook delivery claimed by another instance during the attempt",
+			zap.Uint("delivery_id", delivery.ID),
+			zap.String("job_id", delivery.JobID),
+		)
+		return false
+	}
+	if err != nil {
+		log.Error("Failed to record webhook delivery", zap.Uint("delivery_id", delivery.ID), zap.Error(err))
+	}
+	return true
+}
+
+// wait sleeps for the delay and reports false if deliveries are being stopped instead
+func wait(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-deliveryCtx.Done():
+		return false
+	}
+}
+
+// send makes a single delivery attempt and returns the HTTP status, if any
+func send(delivery db.WebhookDelivery) (int, error) {
+	settings := config.AppConfig.Webhooks
+
+	ctx := deliveryCtx
+	if settings.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, settings.Timeout)
+		defer cancel()
+	}
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	if settings.Secret != "" {
+		req.Header.Set(HeaderSignature, "sha256="+sign(settings.Secret, body))
+	}
+
+	resp, err := clientFor(delivery.URL).Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// sign returns the hex HMAC-SHA256 of the body keyed with the secret
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryDelay returns the exponential backoff before the attempt following the given one.
+// A max_delay of 0 leaves the backoff uncapped.
+func retryDelay(attempt int) time.Duration {
+	settings := config.AppConfig.Webhooks
+
+	delay := settings.BaseDelay
+	for i := 1; i < attempt && delay < math.MaxInt64/2; i++ {
+		if settings.MaxDelay > 0 && delay >= settings.MaxDelay {
+			break
+		}
+		delay *= 2
+	}
+	if settings.MaxDelay > 0 && delay > settings.MaxDelay {
+		delay = settings.MaxDelay
+	}
+	return delay
+}